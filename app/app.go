@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/util"
+	"go.uber.org/multierr"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// Runnable is a server or background worker managed by an App. Run blocks
+// until ctx is cancelled and the work is stopped, or the work failed.
+type Runnable interface {
+	Run(ctx context.Context) error
+}
+
+// RunnableFunc adapts a function to a Runnable
+type RunnableFunc func(ctx context.Context) error
+
+// Run calls f(ctx)
+func (f RunnableFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// App runs several servers and background workers in one process. A single
+// shutdown signal, or the failure of any of them, stops all of them.
+type App struct {
+	name      string
+	runnables []namedRunnable
+	// Time granted to all runnables to stop once the shutdown started
+	shutdownTimeout time.Duration
+	// Signals starting the shutdown
+	signals []os.Signal
+	// Run in order once all runnables stopped
+	hooks util.ShutdownHooks
+	// Logger interface
+	log logger.Logger
+	// Reports the process ready to systemd, util.SdServing
+	sdServing func(log logger.Logger) (stop func())
+}
+
+type namedRunnable struct {
+	name string
+	r    Runnable
+	// Servers report with util.Ready when they serve
+	server bool
+}
+
+type result struct {
+	idx int
+	err error
+}
+
+// Option configures an App
+type Option func(*App)
+
+// WithShutdownTimeout sets the time granted to all runnables to stop (default 30s)
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(a *App) { a.shutdownTimeout = d }
+}
+
+// WithSignals replaces the signals starting the shutdown (default util.DefaultSignals)
+func WithSignals(sig ...os.Signal) Option {
+	return func(a *App) { a.signals = sig }
+}
+
+// New returns an App without runnables
+func New(name string, opts ...Option) *App {
+	a := &App{
+		name:            name,
+		shutdownTimeout: defaultShutdownTimeout,
+		signals:         util.DefaultSignals,
+		log:             logger.WithName(name),
+		sdServing:       util.SdServing,
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Add registers a runnable under name
+func (a *App) Add(name string, r Runnable) {
+	a.runnables = append(a.runnables, namedRunnable{name: name, r: r})
+}
+
+// AddFunc registers a function as runnable under name
+func (a *App) AddFunc(name string, f func(ctx context.Context) error) {
+	a.Add(name, RunnableFunc(f))
+}
+
+// AddServer registers a server under name. Its Run reports that it serves
+// with util.Ready(ctx), ServeContext of the server package does so once its
+// listener is bound. The process is reported ready to systemd once all
+// servers did, a server failing to bind keeps it from ever being reported.
+func (a *App) AddServer(name string, r Runnable) {
+	a.runnables = append(a.runnables, namedRunnable{name: name, r: r, server: true})
+}
+
+// AddServerFunc registers a function as server under name, see AddServer
+func (a *App) AddServerFunc(name string, f func(ctx context.Context) error) {
+	a.AddServer(name, RunnableFunc(f))
+}
+
+// AddShutdownHook registers a hook run in order once all runnables stopped,
+// e.g. database.CloseHook or util.LoggerSyncHook
+func (a *App) AddShutdownHook(hook util.ShutdownHook) {
+	a.hooks.AddHook(hook)
+}
+
+// Run starts all runnables and blocks until they stopped. The shutdown starts
+// on a signal or when a runnable fails, a second signal exits immediately. The errors of all runnables are
+// returned combined; nil means every runnable stopped cleanly.
+func (a *App) Run() error {
+	shutdown := util.NewShutdownWaitGroup(a.signals...)
+	defer shutdown.Stop()
+	return a.RunContext(shutdown.Context())
+}
+
+// RunContext is Run with the shutdown started by cancelling ctx instead of signals
+func (a *App) RunContext(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(a.runnables))
+	ready := make(chan int, len(a.runnables))
+	running := map[int]string{}
+	// Servers not serving yet
+	pending := map[int]bool{}
+	for i, nr := range a.runnables {
+		i, nr := i, nr
+		running[i] = nr.name
+		rctx := runCtx
+		if nr.server {
+			pending[i] = true
+			var once sync.Once
+			rctx = util.WithReady(runCtx, func() { once.Do(func() { ready <- i }) })
+		}
+		a.log.Info("starting", "runnable", nr.name)
+		go func() {
+			results <- result{idx: i, err: runSafely(rctx, nr.r)}
+		}()
+	}
+
+	// Report ready to systemd once all servers serve and ping its watchdog until the shutdown
+	stopNotify := func() {}
+	defer func() { stopNotify() }()
+	serving := func() {
+		a.log.Info("all servers serving")
+		stopNotify = a.sdServing(a.log)
+	}
+	if len(pending) == 0 {
+		serving()
+	}
+
+	var errs error
+	collect := func(res result) {
+		name := running[res.idx]
+		delete(running, res.idx)
+		if res.err != nil {
+			a.log.Error(res.err, "runnable failed", "runnable", name)
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", name, res.err))
+		} else {
+			a.log.Info("runnable stopped", "runnable", name)
+		}
+	}
+
+	// Wait for the shutdown trigger, runnables may finish cleanly before that
+	for len(running) > 0 && errs == nil && runCtx.Err() == nil {
+		select {
+		case <-runCtx.Done():
+			a.log.Info("shutdown requested")
+		case i := <-ready:
+			if pending[i] {
+				delete(pending, i)
+				if len(pending) == 0 {
+					serving()
+				}
+			}
+		case res := <-results:
+			collect(res)
+		}
+	}
+	cancel()
+	stopNotify()
+	util.SdStopping(a.log)
+
+	timeout := time.NewTimer(a.shutdownTimeout)
+	defer timeout.Stop()
+	for len(running) > 0 {
+		select {
+		case res := <-results:
+			collect(res)
+		case <-timeout.C:
+			names := make([]string, 0, len(running))
+			for _, name := range running {
+				names = append(names, name)
+			}
+			err := fmt.Errorf("shutdown exceeded %s, still running: %s", a.shutdownTimeout, strings.Join(names, ", "))
+			a.log.Error(err, "shutdown timed out")
+			return a.runHooks(multierr.Append(errs, err))
+		}
+	}
+	a.log.Info("all runnables stopped")
+	return a.runHooks(errs)
+}
+
+// runHooks runs the shutdown hooks and adds their errors to errs
+func (a *App) runHooks(errs error) error {
+	return multierr.Append(errs, a.hooks.RunHooks(context.Background()).Err())
+}
+
+// runSafely turns a panic of the runnable into an error, so the other runnables still stop gracefully
+func runSafely(ctx context.Context, r Runnable) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return r.Run(ctx)
+}
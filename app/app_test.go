@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/server"
+	"github.com/karthikraman22/rpc-bp/util"
+)
+
+func TestRunStopsAllOnCancel(t *testing.T) {
+	grpcSrv := server.NewGrpcServer("app-test-grpc", false)
+	restSrv := server.NewRestServer("app-test-rest", "release", false)
+
+	a := New("app-test")
+	a.AddFunc("grpc", func(ctx context.Context) error { return grpcSrv.Run(ctx, "127.0.0.1:0") })
+	a.AddFunc("rest", func(ctx context.Context) error { return restSrv.Run(ctx, "127.0.0.1:0") })
+	a.AddFunc("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := a.RunContext(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+func TestRunStopsAllOnFailure(t *testing.T) {
+	stopped := make(chan struct{})
+	a := New("app-test")
+	a.AddFunc("failing", func(ctx context.Context) error { return errors.New("boom") })
+	a.AddFunc("panicking", func(ctx context.Context) error {
+		<-ctx.Done()
+		panic("worker panicked")
+	})
+	a.AddFunc("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	})
+
+	err := a.RunContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failing: boom") || !strings.Contains(err.Error(), "panicking: panic: worker panicked") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("worker was not stopped")
+	}
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	a := New("app-test", WithShutdownTimeout(50*time.Millisecond))
+	a.AddFunc("stuck", func(ctx context.Context) error {
+		select {}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.RunContext(ctx); err == nil || !strings.Contains(err.Error(), "still running: stuck") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestRunShutdownHooksInOrder(t *testing.T) {
+	var mu sync.Mutex
+	order := []string{}
+	hook := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	a := New("app-test")
+	a.AddFunc("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	a.AddShutdownHook(util.ShutdownHook{Name: "logs", Priority: util.PriorityLoggers, Run: hook("logs")})
+	a.AddShutdownHook(util.ShutdownHook{Name: "db", Priority: util.PriorityDatabase, Run: hook("db")})
+	a.AddShutdownHook(util.ShutdownHook{Name: "stuck", Priority: util.PriorityWorkers, Timeout: 50 * time.Millisecond, Run: func(ctx context.Context) error {
+		select {}
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := a.RunContext(ctx)
+	if err == nil || !strings.Contains(err.Error(), "stuck: context deadline exceeded") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if strings.Join(order, ",") != "db,logs" {
+		t.Fatalf("unexpected hook order %v", order)
+	}
+}
+
+func TestRunStopsOnSignal(t *testing.T) {
+	a := New("app-test", WithSignals(syscall.SIGUSR2))
+	a.AddFunc("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	time.AfterFunc(100*time.Millisecond, func() { _ = syscall.Kill(syscall.Getpid(), syscall.SIGUSR2) })
+	if err := a.Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+func TestReadyOnceAllServersServe(t *testing.T) {
+	grpcSrv := server.NewGrpcServer("app-test-grpc", false)
+	restSrv := server.NewRestServer("app-test-rest", "release", false)
+
+	a := New("app-test")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var readyCalls int32
+	a.sdServing = func(logger.Logger) func() {
+		atomic.AddInt32(&readyCalls, 1)
+		cancel()
+		return func() {}
+	}
+	a.AddServerFunc("grpc", func(ctx context.Context) error { return grpcSrv.Run(ctx, "127.0.0.1:0") })
+	a.AddServerFunc("rest", func(ctx context.Context) error { return restSrv.Run(ctx, "127.0.0.1:0") })
+	a.AddFunc("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	if err := a.RunContext(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if n := atomic.LoadInt32(&readyCalls); n != 1 {
+		t.Fatalf("reported ready %d times", n)
+	}
+}
+
+func TestNotReadyWhenBindFails(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	grpcSrv := server.NewGrpcServer("app-test-grpc", false)
+	restSrv := server.NewRestServer("app-test-rest", "release", false)
+
+	a := New("app-test")
+	var readyCalls int32
+	a.sdServing = func(logger.Logger) func() {
+		atomic.AddInt32(&readyCalls, 1)
+		return func() {}
+	}
+	a.AddServerFunc("grpc", func(ctx context.Context) error { return grpcSrv.Run(ctx, busy.Addr().String()) })
+	a.AddServerFunc("rest", func(ctx context.Context) error { return restSrv.Run(ctx, "127.0.0.1:0") })
+
+	if err := a.RunContext(context.Background()); err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := atomic.LoadInt32(&readyCalls); n != 0 {
+		t.Fatal("reported ready although a server failed to bind")
+	}
+}
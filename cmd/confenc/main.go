@@ -0,0 +1,75 @@
+// Command confenc encrypts a configuration value with the kek keyset so it can
+// be pasted into the config file, e.g.
+//
+//	confenc -kek aead_keyset.bin -key db.password 'ZAQ1@wsx'
+//
+// which prints `enc:v1:...`. Use -generate to create a new kek keyset, or
+// -generate -prf to create a blind index keyset.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/karthikraman22/rpc-bp/config"
+	"github.com/karthikraman22/rpc-bp/security"
+)
+
+func main() {
+	kekPath := flag.String("kek", "aead_keyset.bin", "path to the kek keyset")
+	key := flag.String("key", "", "config key the value is stored under as written in the config file, e.g. db.poolSize")
+	generate := flag.Bool("generate", false, "generate a new kek keyset at -kek and exit")
+	prf := flag.Bool("prf", false, "with -generate, create a blind index keyset instead")
+	flag.Parse()
+
+	if *generate {
+		if _, err := os.Stat(*kekPath); err == nil {
+			fail(fmt.Errorf("%s already exists", *kekPath))
+		}
+		gen := security.GenerateKeysetFile
+		if *prf {
+			gen = security.GenerateBlindIndexKeysetFile
+		}
+		if err := gen(*kekPath); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	if *key == "" {
+		fail(fmt.Errorf("-key is required"))
+	}
+	value, err := readValue()
+	if err != nil {
+		fail(err)
+	}
+	kms, err := security.NewKMS(*kekPath)
+	if err != nil {
+		fail(err)
+	}
+	enc, err := config.EncryptValue(kms, *key, value)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(enc)
+}
+
+// readValue takes the plaintext from the first argument or the first line of stdin
+func readValue() (string, error) {
+	if flag.NArg() > 0 {
+		return flag.Arg(0), nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no value given: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "confenc:", err)
+	os.Exit(1)
+}
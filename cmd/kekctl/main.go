@@ -0,0 +1,147 @@
+// Command kekctl manages the versions of the kek keyset and re-encrypts
+// stored data keys after a rotation.
+//
+//	kekctl -kek aead_keyset.bin list
+//	kekctl -kek aead_keyset.bin add
+//	kekctl -kek aead_keyset.bin promote <key-id>
+//	kekctl -config conf.yaml reencrypt -table users -pk id -column phone
+//	kekctl -kek aead_keyset.bin disable <key-id>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/karthikraman22/rpc-bp/config"
+	"github.com/karthikraman22/rpc-bp/database"
+	"github.com/karthikraman22/rpc-bp/security"
+	"github.com/karthikraman22/rpc-bp/util"
+)
+
+func main() {
+	kekPath := flag.String("kek", "", "path to the kek keyset (defaults to the kek setting of -config)")
+	confPath := flag.String("config", "", "config file, required for reencrypt")
+	envPrefix := flag.String("env-prefix", "", "environment variable prefix of the config")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: kekctl [flags] list|add|rotate|promote <id>|disable <id>|enable <id>|reencrypt [reencrypt flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var cfg *config.Config
+	if *confPath != "" {
+		var err error
+		if cfg, err = config.NewConfig(*confPath, *envPrefix); err != nil {
+			fail(err)
+		}
+		if *kekPath == "" {
+			*kekPath = cfg.KekPath()
+		}
+	}
+	args := flag.Args()
+	if *kekPath == "" && args[0] != "reencrypt" {
+		fail(fmt.Errorf("-kek or -config is required"))
+	}
+
+	switch args[0] {
+	case "list":
+		keys, err := security.ListKeys(*kekPath)
+		if err != nil {
+			fail(err)
+		}
+		for _, k := range keys {
+			primary := ""
+			if k.Primary {
+				primary = "primary"
+			}
+			fmt.Printf("%d\t%s\t%s\n", k.ID, k.Status, primary)
+		}
+	case "add":
+		id, err := security.AddKey(*kekPath)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println(id)
+	case "rotate":
+		id, err := security.AddKey(*kekPath)
+		if err != nil {
+			fail(err)
+		}
+		if err := security.PromoteKey(*kekPath, id); err != nil {
+			fail(err)
+		}
+		fmt.Println(id)
+	case "promote", "disable", "enable":
+		id := keyIDArg(args)
+		ops := map[string]func(string, uint32) error{
+			"promote": security.PromoteKey,
+			"disable": security.DisableKey,
+			"enable":  security.EnableKey,
+		}
+		if err := ops[args[0]](*kekPath, id); err != nil {
+			fail(err)
+		}
+	case "reencrypt":
+		if cfg == nil {
+			fail(fmt.Errorf("reencrypt requires -config"))
+		}
+		reencrypt(cfg, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func reencrypt(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	target := database.ReencryptTarget{}
+	fs.StringVar(&target.Table, "table", "", "table name")
+	fs.StringVar(&target.PrimaryKey, "pk", "id", "primary key column")
+	fs.StringVar(&target.Column, "column", "", "encrypted column")
+	batch := fs.Int("batch", 500, "rows per batch")
+	fs.Parse(args)
+	if target.Table == "" || target.Column == "" {
+		fail(fmt.Errorf("reencrypt requires -table and -column"))
+	}
+
+	kms, err := cfg.KMS()
+	if err != nil {
+		fail(err)
+	}
+	db, err := database.InitDatabase(cfg)
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), util.DefaultSignals...)
+	defer stop()
+	stats, err := database.ReencryptTable(ctx, db, kms, target, *batch)
+	fmt.Printf("scanned=%d rewrapped=%d skipped=%d\n", stats.Scanned, stats.Rewrapped, stats.Skipped)
+	if err != nil {
+		fail(err)
+	}
+}
+
+func keyIDArg(args []string) uint32 {
+	if len(args) < 2 {
+		fail(fmt.Errorf("%s requires a key id", args[0]))
+	}
+	id, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		fail(err)
+	}
+	return uint32(id)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "kekctl:", err)
+	os.Exit(1)
+}
@@ -13,6 +13,8 @@ import (
 
 type Config struct {
 	*koanf.Koanf
+	// Path of the loaded config file
+	file string
 }
 
 func NewConfig(fname string, envPrefix string) (*Config, error) {
@@ -34,6 +36,18 @@ func NewConfig(fname string, envPrefix string) (*Config, error) {
 	}), nil)
 	if err != nil {
 		log.Error(err, "config_env_load_error")
+		return &Config{Koanf: conf, file: fname}, err
 	}
-	return &Config{conf}, err
+
+	cfg := &Config{Koanf: conf, file: fname}
+	// Decrypt `enc:` prefixed values with the kek keyset
+	n, err := cfg.decryptValues()
+	if err != nil {
+		log.Error(err, "config_decrypt_error")
+		return nil, err
+	}
+	if n > 0 {
+		log.Info("decrypted configuration values", "count", n)
+	}
+	return cfg, nil
 }
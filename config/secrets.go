@@ -0,0 +1,120 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/karthikraman22/rpc-bp/security"
+
+	"github.com/knadh/koanf/providers/confmap"
+)
+
+const (
+	// EncryptedPrefix marks a configuration value as ciphertext produced by EncryptValue
+	EncryptedPrefix = "enc:v1:"
+	// KekKey is the configuration key holding the path to the kek keyset
+	KekKey = "kek"
+)
+
+var (
+	// ErrKMSNotConfigured is returned by Config.KMS if no kek is configured
+	ErrKMSNotConfigured = errors.New("config: no kek configured")
+)
+
+// EncryptValue encrypts a configuration value so it can be stored in the config file.
+// The key path is bound as associated data, the value only decrypts under the same key.
+func EncryptValue(kms *security.KMS, key, plaintext string) (string, error) {
+	ct, err := kms.Encrypt([]byte(plaintext), []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return EncryptedPrefix + base64.RawURLEncoding.EncodeToString(ct), nil
+}
+
+// DecryptValue decrypts a configuration value produced by EncryptValue
+func DecryptValue(kms *security.KMS, key, value string) (string, error) {
+	ct, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("config: malformed encrypted value for %q: %w", key, err)
+	}
+	pt, err := kms.Decrypt(ct, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("config: decrypt %q: %w", key, err)
+	}
+	return string(pt), nil
+}
+
+// IsEncrypted reports whether the value carries the EncryptedPrefix
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+// KekPath resolves the kek keyset path, relative paths are taken from the config file directory
+func (c *Config) KekPath() string {
+	return c.Path(KekKey)
+}
+
+// Path resolves a file path configured under key, relative paths are taken from the config file directory
+func (c *Config) Path(key string) string {
+	p := c.String(key)
+	if p == "" || filepath.IsAbs(p) || c.file == "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(c.file), p)
+}
+
+// KMS returns a KMS for the KEK provider selected by `kms.provider`:
+//
+//	file:  the keyset file at `kek` (default)
+//	vault: the transit key `kms.vault.key` of the vault at `kms.vault.address`
+func (c *Config) KMS() (*security.KMS, error) {
+	switch provider := c.String("kms.provider"); provider {
+	case "", "file":
+		kekPath := c.KekPath()
+		if kekPath == "" {
+			return nil, ErrKMSNotConfigured
+		}
+		return security.NewKMS(kekPath)
+	case "vault":
+		return security.NewKMSWithProvider(security.NewVaultProvider(security.VaultConfig{
+			Address:   c.String("kms.vault.address"),
+			Token:     c.String("kms.vault.token"),
+			Namespace: c.String("kms.vault.namespace"),
+			Mount:     c.String("kms.vault.mount"),
+			Key:       c.String("kms.vault.key"),
+			Timeout:   c.Duration("kms.vault.timeout"),
+		}))
+	default:
+		return nil, fmt.Errorf("config: unknown kms provider %q", provider)
+	}
+}
+
+// decryptValues replaces every encrypted value in conf with its plaintext.
+// The KMS is only created if there is at least one encrypted value.
+func (c *Config) decryptValues() (int, error) {
+	encrypted := map[string]interface{}{}
+	for k, v := range c.All() {
+		if s, ok := v.(string); ok && IsEncrypted(s) {
+			encrypted[k] = s
+		}
+	}
+	if len(encrypted) == 0 {
+		return 0, nil
+	}
+
+	kms, err := c.KMS()
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range encrypted {
+		pt, err := DecryptValue(kms, k, v.(string))
+		if err != nil {
+			return 0, err
+		}
+		encrypted[k] = pt
+	}
+	return len(encrypted), c.Load(confmap.Provider(encrypted, "."), nil)
+}
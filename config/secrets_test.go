@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/karthikraman22/rpc-bp/security"
+)
+
+func TestNewConfigDecryptsValues(t *testing.T) {
+	dir := t.TempDir()
+	kekPath := filepath.Join(dir, "aead_keyset.bin")
+	if err := security.GenerateKeysetFile(kekPath); err != nil {
+		t.Fatalf("generate keyset: %v", err)
+	}
+	kms, err := security.NewKMS(kekPath)
+	if err != nil {
+		t.Fatalf("new kms: %v", err)
+	}
+	// Encrypted the way confenc does, under the key as written in the file
+	password, err := EncryptValue(kms, "db.password", "ZAQ1@wsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolSize, err := EncryptValue(kms, "db.poolSize", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fname := filepath.Join(dir, "conf.yaml")
+	conf := "kek: aead_keyset.bin\ndb:\n  password: " + password + "\n  poolSize: " + poolSize + "\n"
+	if err := os.WriteFile(fname, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewConfig(fname, "RPCBP_TEST_")
+	if err != nil {
+		t.Fatalf("new config: %v", err)
+	}
+	if got := cfg.String("db.password"); got != "ZAQ1@wsx" {
+		t.Fatalf("db.password: got %q", got)
+	}
+	if got := cfg.Int("db.poolSize"); got != 2 {
+		t.Fatalf("db.poolSize: got %d", got)
+	}
+
+	// A value moved to another key does not decrypt
+	conf = "kek: aead_keyset.bin\ndb:\n  user: " + password + "\n"
+	if err := os.WriteFile(fname, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewConfig(fname, "RPCBP_TEST_"); err == nil {
+		t.Fatal("value encrypted for db.password decrypted as db.user")
+	}
+}
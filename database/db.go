@@ -1,10 +1,16 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"time"
 
 	"github.com/karthikraman22/rpc-bp/config"
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/security"
+	"github.com/karthikraman22/rpc-bp/util"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -12,6 +18,10 @@ import (
 // Initializes the database with standard configuration
 func InitDatabase(cfg *config.Config) (*gorm.DB, error) {
 
+	if err := initEncryption(cfg); err != nil {
+		return nil, err
+	}
+
 	connectionString := fmt.Sprintf("%s://%s:%s@%s:%d/%s?sslmode=%s", cfg.String("db.driver"),
 		cfg.String("db.user"), cfg.String("db.password"), cfg.String("db.host"), cfg.Int("db.port"),
 		cfg.String("db.database"), cfg.String("db.sslmode"))
@@ -20,6 +30,10 @@ func InitDatabase(cfg *config.Config) (*gorm.DB, error) {
 	if db, err := gorm.Open(postgres.New(postgres.Config{DSN: connectionString}), &gormCfg); err != nil {
 		return nil, err
 	} else {
+		// Trace every SQL statement, spans are no-ops unless tracing is initialized
+		if err := db.Use(NewGormTracing()); err != nil {
+			return nil, err
+		}
 		sqlDB, err := db.DB()
 		if err == nil {
 			// SetMaxOpenConns sets the maximum number of open connections to the database.
@@ -29,3 +43,49 @@ func InitDatabase(cfg *config.Config) (*gorm.DB, error) {
 		return db, err
 	}
 }
+
+// Registers the KMS and blind index keyset used by the security column types.
+// A configured but missing keyset only disables the column types.
+func initEncryption(cfg *config.Config) error {
+	log := logger.WithName("database")
+
+	kms, err := cfg.KMS()
+	switch {
+	case errors.Is(err, config.ErrKMSNotConfigured):
+	case errors.Is(err, fs.ErrNotExist):
+		log.Warn("kek keyset not found, encrypted columns disabled", "path", cfg.KekPath())
+	case err != nil:
+		return err
+	default:
+		security.SetDefaultKMS(kms)
+	}
+
+	if bidxPath := cfg.Path("blindindex"); bidxPath != "" {
+		indexer, err := security.NewBlindIndexer(bidxPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			log.Warn("blind index keyset not found, blind indexes disabled", "path", bidxPath)
+		case err != nil:
+			return err
+		default:
+			security.SetDefaultBlindIndexer(indexer)
+		}
+	}
+	return nil
+}
+
+// CloseHook returns a shutdown hook closing the connection pool of db once the servers stopped
+func CloseHook(db *gorm.DB) util.ShutdownHook {
+	return util.ShutdownHook{
+		Name:     "database",
+		Priority: util.PriorityDatabase,
+		Timeout:  10 * time.Second,
+		Run: func(context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.Close()
+		},
+	}
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/karthikraman22/rpc-bp/security"
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer encrypts a column with the default security.KMS and
+// binds the envelope to its table, column and primary key, fields use it with
+// the tag `gorm:"serializer:encrypted"`. Unlike security.EncryptedString and
+// security.EncryptedJSON, an envelope copied to another row or column no
+// longer decrypts. The price is that the primary key must be set before the
+// row is created, database generated keys cannot be used, and queries must
+// select the primary key ahead of the column. String and []byte fields are
+// stored as is, other types as JSON.
+type EncryptedSerializer struct{}
+
+// Scan implements schema.SerializerInterface
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var ct []byte
+	switch v := dbValue.(type) {
+	case nil:
+		return nil
+	case []byte:
+		ct = v
+	case string:
+		ct = []byte(v)
+	default:
+		return fmt.Errorf("database: cannot scan %T into encrypted column %s", dbValue, field.DBName)
+	}
+	k := security.DefaultKMS()
+	if k == nil {
+		return security.ErrNoKMS
+	}
+	ad, err := encryptedAssociatedData(ctx, field, dst)
+	if err != nil {
+		return err
+	}
+	pt, err := k.Decrypt(ct, ad)
+	if err != nil {
+		return fmt.Errorf("database: decrypt %s.%s: %w", field.Schema.Table, field.DBName, err)
+	}
+
+	fieldValue := reflect.New(field.FieldType)
+	switch elem := fieldValue.Elem(); {
+	case elem.Kind() == reflect.String:
+		elem.SetString(string(pt))
+	case elem.Kind() == reflect.Slice && elem.Type().Elem().Kind() == reflect.Uint8:
+		elem.SetBytes(pt)
+	default:
+		if err := json.Unmarshal(pt, fieldValue.Interface()); err != nil {
+			return err
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+// Value implements schema.SerializerValuerInterface
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var pt []byte
+	switch v := reflect.ValueOf(fieldValue); {
+	case !v.IsValid():
+		return nil, nil
+	case v.Kind() == reflect.String:
+		pt = []byte(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		if v.IsNil() {
+			return nil, nil
+		}
+		pt = v.Bytes()
+	default:
+		b, err := json.Marshal(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+		pt = b
+	}
+	k := security.DefaultKMS()
+	if k == nil {
+		return nil, security.ErrNoKMS
+	}
+	ad, err := encryptedAssociatedData(ctx, field, dst)
+	if err != nil {
+		return nil, err
+	}
+	return k.Encrypt(pt, ad)
+}
+
+// encryptedAssociatedData names the table, column and primary key of the row dst
+func encryptedAssociatedData(ctx context.Context, field *schema.Field, dst reflect.Value) ([]byte, error) {
+	if len(field.Schema.PrimaryFields) == 0 {
+		return nil, fmt.Errorf("database: encrypted column %s.%s needs a primary key", field.Schema.Table, field.DBName)
+	}
+	parts := []string{field.Schema.Table, field.DBName}
+	for _, pf := range field.Schema.PrimaryFields {
+		v, zero := pf.ValueOf(ctx, dst)
+		if zero {
+			return nil, fmt.Errorf("database: encrypted column %s.%s needs the primary key %s set", field.Schema.Table, field.DBName, pf.DBName)
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return []byte(strings.Join(parts, "\x00")), nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/karthikraman22/rpc-bp/security"
+	"gorm.io/gorm/schema"
+)
+
+type encryptedAccount struct {
+	ID    string
+	Vpa   string            `gorm:"serializer:encrypted"`
+	Phone string            `gorm:"serializer:encrypted"`
+	Prefs map[string]string `gorm:"serializer:encrypted"`
+}
+
+func TestEncryptedSerializer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aead_keyset.bin")
+	if err := security.GenerateKeysetFile(path); err != nil {
+		t.Fatal(err)
+	}
+	kms, err := security.NewKMS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	security.SetDefaultKMS(kms)
+	defer security.SetDefaultKMS(nil)
+
+	s, err := schema.Parse(&encryptedAccount{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ser := EncryptedSerializer{}
+	vpa, phone, prefs := s.LookUpField("Vpa"), s.LookUpField("Phone"), s.LookUpField("Prefs")
+
+	a := &encryptedAccount{ID: "a1", Vpa: "9876543210@upi", Prefs: map[string]string{"lang": "en"}}
+	ct, err := ser.Value(ctx, vpa, reflect.ValueOf(a).Elem(), a.Vpa)
+	if err != nil {
+		t.Fatalf("value: %v", err)
+	}
+	jct, err := ser.Value(ctx, prefs, reflect.ValueOf(a).Elem(), a.Prefs)
+	if err != nil {
+		t.Fatalf("json value: %v", err)
+	}
+
+	got := &encryptedAccount{ID: "a1"}
+	if err := ser.Scan(ctx, vpa, reflect.ValueOf(got).Elem(), ct); err != nil || got.Vpa != a.Vpa {
+		t.Fatalf("scan: got %q, %v", got.Vpa, err)
+	}
+	if err := ser.Scan(ctx, prefs, reflect.ValueOf(got).Elem(), jct); err != nil || got.Prefs["lang"] != "en" {
+		t.Fatalf("json scan: got %v, %v", got.Prefs, err)
+	}
+
+	// Copied to another row or another column
+	other := &encryptedAccount{ID: "a2"}
+	if err := ser.Scan(ctx, vpa, reflect.ValueOf(other).Elem(), ct); err == nil {
+		t.Fatal("decrypted the envelope of another row")
+	}
+	if err := ser.Scan(ctx, phone, reflect.ValueOf(got).Elem(), ct); err == nil {
+		t.Fatal("decrypted the envelope of another column")
+	}
+	// Without the primary key
+	if _, err := ser.Value(ctx, vpa, reflect.ValueOf(&encryptedAccount{}).Elem(), "x"); err == nil {
+		t.Fatal("encrypted without primary key")
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	gormSpanKey         = "otel:span"
+	tracingInstrumentor = "github.com/karthikraman22/rpc-bp/database"
+)
+
+// GormTracing is a gorm plugin creating an OpenTelemetry span for every SQL
+// statement. The spans of Row and Rows end once the query is sent, gorm has
+// no callback once the caller scanned the rows: they cover the dispatch and
+// the first result, not the time spent reading the rows.
+type GormTracing struct {
+	tracer trace.Tracer
+}
+
+// NewGormTracing returns the plugin using the tracer of the global tracer
+// provider, register it with db.Use
+func NewGormTracing() *GormTracing {
+	return &GormTracing{tracer: otel.Tracer(tracingInstrumentor)}
+}
+
+// Name implements gorm.Plugin
+func (gt *GormTracing) Name() string {
+	return "otel-tracing"
+}
+
+// Initialize implements gorm.Plugin, it registers the callbacks starting and
+// ending the spans around the statements of db
+func (gt *GormTracing) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		op     string
+		before func(name string, fn func(*gorm.DB)) error
+		after  func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		// Ends before the caller scans the rows, see GormTracing
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.before("otel:before_"+h.op, gt.before(h.op)); err != nil {
+			return err
+		}
+		if err := h.after("otel:after_"+h.op, gt.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gt *GormTracing) before(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, span := gt.tracer.Start(db.Statement.Context, "gorm."+op,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(dbSystem(db.Dialector), semconv.DBOperationKey.String(op)))
+		db.Statement.Context = ctx
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+// dbSystem maps the name of the gorm dialector to the db.system attribute
+func dbSystem(dialector gorm.Dialector) attribute.KeyValue {
+	switch name := dialector.Name(); name {
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "sqlite":
+		return semconv.DBSystemSqlite
+	case "sqlserver":
+		return semconv.DBSystemMSSQL
+	default:
+		return semconv.DBSystemKey.String(name)
+	}
+}
+
+func (gt *GormTracing) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBStatementKey.String(db.Statement.SQL.String()),
+		semconv.DBSQLTableKey.String(db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestGormTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewGormTracing()); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("SELECT 1")
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "gorm.raw" {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	attrs := map[string]string{}
+	for _, kv := range spans[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	// The system is taken from the dialector
+	if attrs[string(semconv.DBSystemKey)] != "dummy" || attrs[string(semconv.DBStatementKey)] != "SELECT 1" {
+		t.Fatalf("got attributes %v", attrs)
+	}
+	if got := dbSystem(postgresDialector{}); got != semconv.DBSystemPostgreSQL {
+		t.Fatalf("got %v for postgres", got)
+	}
+}
+
+type postgresDialector struct {
+	tests.DummyDialector
+}
+
+func (postgresDialector) Name() string {
+	return "postgres"
+}
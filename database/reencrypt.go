@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/security"
+	"gorm.io/gorm"
+)
+
+// ReencryptTarget identifies an envelope encrypted column of a table
+type ReencryptTarget struct {
+	// Table name
+	Table string
+	// Primary key column, must be orderable
+	PrimaryKey string
+	// Column holding the security.KMS envelope
+	Column string
+}
+
+// ReencryptStats summarizes a re-encryption run
+type ReencryptStats struct {
+	Scanned   int
+	Rewrapped int
+	// Rows modified concurrently between read and update, they are picked up by the next run
+	Skipped int
+}
+
+// ReencryptTable rewraps the data keys of target under the primary KEK version.
+// Rows are walked in primary key order in batches of batchSize. Updates are
+// conditional on the column still holding the value read, so the job can run
+// while the application keeps writing.
+func ReencryptTable(ctx context.Context, db *gorm.DB, kms *security.KMS, target ReencryptTarget, batchSize int) (ReencryptStats, error) {
+	log := logger.WithName("reencrypt")
+	stats := ReencryptStats{}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	log.Info("reencrypt started", "table", target.Table, "column", target.Column, "primary_key_id", kms.PrimaryKeyID())
+	var last interface{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		q := db.WithContext(ctx).Table(target.Table).
+			Select(target.PrimaryKey, target.Column).
+			Where(fmt.Sprintf("%s IS NOT NULL", target.Column)).
+			Order(target.PrimaryKey).
+			Limit(batchSize)
+		if last != nil {
+			q = q.Where(fmt.Sprintf("%s > ?", target.PrimaryKey), last)
+		}
+		rows, err := q.Rows()
+		if err != nil {
+			return stats, err
+		}
+
+		type row struct {
+			pk  interface{}
+			val []byte
+		}
+		batch := make([]row, 0, batchSize)
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.pk, &r.val); err != nil {
+				rows.Close()
+				return stats, err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return stats, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		rewrapped, skipped := 0, 0
+		for _, r := range batch {
+			ct, changed, err := kms.Rewrap(r.val)
+			if err != nil {
+				return stats, fmt.Errorf("database: rewrap %s.%s %s=%v: %w", target.Table, target.Column, target.PrimaryKey, r.pk, err)
+			}
+			if !changed {
+				continue
+			}
+			res := db.WithContext(ctx).Table(target.Table).
+				Where(fmt.Sprintf("%s = ? AND %s = ?", target.PrimaryKey, target.Column), r.pk, r.val).
+				Update(target.Column, ct)
+			if res.Error != nil {
+				return stats, res.Error
+			}
+			if res.RowsAffected == 0 {
+				skipped++
+			} else {
+				rewrapped++
+			}
+		}
+		stats.Scanned += len(batch)
+		stats.Rewrapped += rewrapped
+		stats.Skipped += skipped
+		last = batch[len(batch)-1].pk
+
+		log.Info("reencrypt batch", "table", target.Table, "column", target.Column, "rows", len(batch), "rewrapped", rewrapped, "skipped", skipped, "last_pk", last)
+	}
+
+	log.Info("reencrypt finished", "table", target.Table, "column", target.Column, "scanned", stats.Scanned, "rewrapped", stats.Rewrapped, "skipped", stats.Skipped)
+	return stats, nil
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/karthikraman22/rpc-bp/security"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/utils/tests"
+)
+
+// fakeTable is a table of an int64 primary key and one binary column, served
+// by fakeDriver to the two statements ReencryptTable runs
+type fakeTable struct {
+	mu   sync.Mutex
+	rows map[int64][]byte
+	// Called with the primary keys of every batch selected, the table is locked
+	afterSelect func(pks []int64)
+}
+
+var limitRe = regexp.MustCompile(`LIMIT (\d+)`)
+
+func (t *fakeTable) query(q string, args []driver.NamedValue) (driver.Rows, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !strings.HasPrefix(q, "SELECT") {
+		return nil, fmt.Errorf("unexpected query %s", q)
+	}
+	limit, _ := strconv.Atoi(limitRe.FindStringSubmatch(q)[1])
+	var last int64
+	if len(args) == 1 {
+		last = args[0].Value.(int64)
+	}
+	pks := []int64{}
+	for pk, val := range t.rows {
+		if pk > last && val != nil {
+			pks = append(pks, pk)
+		}
+	}
+	sort.Slice(pks, func(i, j int) bool { return pks[i] < pks[j] })
+	if len(pks) > limit {
+		pks = pks[:limit]
+	}
+	rows := &fakeRows{}
+	for _, pk := range pks {
+		rows.values = append(rows.values, []driver.Value{pk, append([]byte(nil), t.rows[pk]...)})
+	}
+	if t.afterSelect != nil {
+		t.afterSelect(pks)
+	}
+	return rows, nil
+}
+
+func (t *fakeTable) exec(q string, args []driver.NamedValue) (driver.Result, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !strings.HasPrefix(q, "UPDATE") || len(args) != 3 {
+		return nil, fmt.Errorf("unexpected statement %s", q)
+	}
+	// SET column = ? WHERE pk = ? AND column = ?
+	pk := args[1].Value.(int64)
+	if cur, ok := t.rows[pk]; !ok || !bytes.Equal(cur, args[2].Value.([]byte)) {
+		return driver.RowsAffected(0), nil
+	}
+	t.rows[pk] = args[0].Value.([]byte)
+	return driver.RowsAffected(1), nil
+}
+
+func (t *fakeTable) set(pk int64, val []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rows[pk] = val
+}
+
+func (t *fakeTable) get(pk int64) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rows[pk]
+}
+
+// fakeDialector registers the default callbacks DummyDialector leaves out
+type fakeDialector struct {
+	tests.DummyDialector
+}
+
+func (fakeDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	return nil
+}
+
+type fakeDriver struct{ table *fakeTable }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn(d), nil }
+
+type fakeConn fakeDriver
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c fakeConn) Commit() error                       { return nil }
+func (c fakeConn) Rollback() error                     { return nil }
+
+func (c fakeConn) QueryContext(_ context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.table.query(q, args)
+}
+
+func (c fakeConn) ExecContext(_ context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	return c.table.exec(q, args)
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "secret"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestReencryptTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aead_keyset.bin")
+	if err := security.GenerateKeysetFile(path); err != nil {
+		t.Fatal(err)
+	}
+	kms, err := security.NewKMS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(s string) []byte {
+		ct, err := kms.Encrypt([]byte(s), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ct
+	}
+
+	table := &fakeTable{rows: map[int64][]byte{}}
+	// Rows 1, 2 and 4 under the old key, row 5 NULL
+	old := map[int64][]byte{1: encrypt("one"), 2: encrypt("two"), 4: encrypt("four")}
+	for pk, ct := range old {
+		table.set(pk, ct)
+	}
+	table.set(5, nil)
+
+	newID, err := security.AddKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := security.PromoteKey(path, newID); err != nil {
+		t.Fatal(err)
+	}
+	if err := kms.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// Row 3 already on the current key
+	current := encrypt("three")
+	table.set(3, current)
+	// Row 4 is written by the application between read and update of the second batch
+	concurrent := encrypt("four, changed")
+	table.afterSelect = func(pks []int64) {
+		if len(pks) > 0 && pks[len(pks)-1] == 4 {
+			table.rows[4] = concurrent
+		}
+	}
+
+	sql.Register("fake-reencrypt", fakeDriver{table})
+	sqlDB, err := sql.Open("fake-reencrypt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{ConnPool: sqlDB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := ReencryptTarget{Table: "accounts", PrimaryKey: "id", Column: "secret"}
+	stats, err := ReencryptTable(context.Background(), db, kms, target, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (ReencryptStats{Scanned: 4, Rewrapped: 2, Skipped: 1}) {
+		t.Fatalf("got %+v", stats)
+	}
+
+	for pk, want := range map[int64]string{1: "one", 2: "two"} {
+		ct := table.get(pk)
+		if bytes.Equal(ct, old[pk]) {
+			t.Fatalf("row %d not rewrapped", pk)
+		}
+		if id, ok := security.EnvelopeKeyID(ct); !ok || id != newID {
+			t.Fatalf("row %d wrapped with %d", pk, id)
+		}
+		if pt, err := kms.Decrypt(ct, nil); err != nil || string(pt) != want {
+			t.Fatalf("row %d: got %q, %v", pk, pt, err)
+		}
+	}
+	if !bytes.Equal(table.get(3), current) {
+		t.Fatal("row on the current key rewritten")
+	}
+	if !bytes.Equal(table.get(4), concurrent) {
+		t.Fatal("concurrent change overwritten")
+	}
+}
@@ -1,6 +1,11 @@
 package api
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
 
 type Probe struct {
 	live  *gin.HandlerFunc
@@ -9,6 +14,9 @@ type Probe struct {
 
 var p Probe
 
+// Cleared once the process started to drain, see SetReady
+var ready int32 = 1
+
 func RegLivenessProbe(h gin.HandlerFunc) {
 	p.live = &h
 }
@@ -17,6 +25,21 @@ func RegReadinessProbe(h gin.HandlerFunc) {
 	p.ready = &h
 }
 
+// SetReady flips the readiness probe. While not ready it answers 503 without
+// calling the registered probe, so load balancers stop routing new requests.
+func SetReady(r bool) {
+	var v int32
+	if r {
+		v = 1
+	}
+	atomic.StoreInt32(&ready, v)
+}
+
+// IsReady reports whether the readiness probe may succeed
+func IsReady() bool {
+	return atomic.LoadInt32(&ready) == 1
+}
+
 func LivenessProbe() gin.HandlerFunc {
 	if p.live == nil {
 		return func(c *gin.Context) {
@@ -27,10 +50,17 @@ func LivenessProbe() gin.HandlerFunc {
 }
 
 func ReadinessProbe() gin.HandlerFunc {
-	if p.ready == nil {
-		return func(c *gin.Context) {
-			c.String(200, "ok")
+	h := func(c *gin.Context) {
+		c.String(200, "ok")
+	}
+	if p.ready != nil {
+		h = *p.ready
+	}
+	return func(c *gin.Context) {
+		if !IsReady() {
+			c.String(http.StatusServiceUnavailable, "draining")
+			return
 		}
+		h(c)
 	}
-	return *p.ready
 }
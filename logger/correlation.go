@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"regexp"
+)
+
+// validCorrelationID limits incoming ids to a sane charset and length so they are safe to log and echo
+var validCorrelationID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewCorrelationID generates a random (version 4) UUID
+func NewCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate correlation id: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// CorrelationIDOrNew returns id if it is a valid correlation id, otherwise a new one
+func CorrelationIDOrNew(id string) string {
+	if validCorrelationID.MatchString(id) {
+		return id
+	}
+	return NewCorrelationID()
+}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation id
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, CORRELATION_ID, id)
+}
+
+// CorrelationID returns the correlation id of the request ctx belongs to, or an empty string
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(CORRELATION_ID).(string)
+	return id
+}
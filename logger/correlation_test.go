@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var invalidCorrelationIDs = []string{"", "has space", "line\nbreak", "<script>", strings.Repeat("a", 129)}
+
+func TestCorrelationIDOrNew(t *testing.T) {
+	for _, valid := range []string{"req-1", "0f8fad5b-d9cb-469f-a165-70867728950e", "svc.a:42_b", strings.Repeat("a", 128)} {
+		if got := CorrelationIDOrNew(valid); got != valid {
+			t.Fatalf("%q: got %q", valid, got)
+		}
+	}
+	for _, invalid := range invalidCorrelationIDs {
+		got := CorrelationIDOrNew(invalid)
+		if got == invalid || !validCorrelationID.MatchString(got) || len(got) != 36 {
+			t.Fatalf("%q: got %q, want a new id", invalid, got)
+		}
+	}
+}
+
+func TestGinLoggingHandlerCorrelationID(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	var seen string
+	router := gin.New()
+	router.Use(GinLoggingHandler(WithName("correlation-test")))
+	router.GET("/", func(c *gin.Context) { seen = CorrelationID(c.Request.Context()) })
+
+	do := func(id string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(CORRELATION_ID.String(), id)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Header().Get(CORRELATION_ID.String())
+	}
+	if echoed := do("req-1"); echoed != "req-1" || seen != "req-1" {
+		t.Fatalf("got %q echoed, %q in the context", echoed, seen)
+	}
+	for _, invalid := range invalidCorrelationIDs {
+		if echoed := do(invalid); echoed == invalid || echoed != seen || !validCorrelationID.MatchString(echoed) {
+			t.Fatalf("%q: got %q echoed, %q in the context", invalid, echoed, seen)
+		}
+	}
+}
+
+// headerStream records the header set by the interceptor like a grpc server stream
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestUnaryServerInterceptorCorrelationID(t *testing.T) {
+	interceptor := UnaryServerInterceptor(WithName("correlation-test"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/rpcbp.test.Items/Get"}
+
+	do := func(id string) (echoed []string, seen string) {
+		stream := &headerStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(CORRELATION_ID.String(), id))
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			seen = CorrelationID(ctx)
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stream.header.Get(CORRELATION_ID.String()), seen
+	}
+	if echoed, seen := do("req-1"); len(echoed) != 1 || echoed[0] != "req-1" || seen != "req-1" {
+		t.Fatalf("got %v echoed, %q in the context", echoed, seen)
+	}
+	for _, invalid := range invalidCorrelationIDs {
+		echoed, seen := do(invalid)
+		if len(echoed) != 1 || echoed[0] == invalid || echoed[0] != seen || !validCorrelationID.MatchString(seen) {
+			t.Fatalf("%q: got %v echoed, %q in the context", invalid, echoed, seen)
+		}
+	}
+}
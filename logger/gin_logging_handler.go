@@ -2,10 +2,11 @@ package logger
 
 import (
 	"net"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"google.golang.org/grpc/peer"
+	"github.com/karthikraman22/rpc-bp/realip"
 )
 
 // Gin Logging handler
@@ -13,6 +14,12 @@ func GinLoggingHandler(log Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 
+		// Accept the incoming correlation id or generate one, and echo it to the client
+		correlationId := CorrelationIDOrNew(c.GetHeader(CORRELATION_ID.String()))
+		tc := NewTraceContext(c.GetHeader(TraceparentHeader), strings.Join(c.Request.Header.Values(TracestateHeader), ","), strings.Join(c.Request.Header.Values(BaggageHeader), ",")).withSpan(c.Request.Context())
+		c.Request = c.Request.WithContext(WithTraceContext(WithCorrelationID(c.Request.Context(), correlationId), tc))
+		c.Header(CORRELATION_ID.String(), correlationId)
+
 		// Process the next
 		c.Next()
 
@@ -22,64 +29,25 @@ func GinLoggingHandler(log Logger) gin.HandlerFunc {
 		code := c.Writer.Status()
 		peer_ip, peer_port, scheme := getRemoteAddressFromGinContext(c)
 
-		correlationId := c.Writer.Header().Get("x-correlation-id")
-
 		if c.Writer.Status() >= 500 {
-			log.Info("failed", "x-correlation-id", correlationId, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme, "error", c.Errors.String())
+			log.Info("failed", CORRELATION_ID.String(), correlationId, "trace_id", tc.TraceID, "span_id", tc.SpanID, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme, "error", c.Errors.String())
 		} else {
-			log.Info("success", "x-correlation-id", correlationId, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme)
+			log.Info("success", CORRELATION_ID.String(), correlationId, "trace_id", tc.TraceID, "span_id", tc.SpanID, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme)
 		}
 
 	}
 }
 
+// getRemoteAddressFromGinContext returns the client resolved by realip, behind
+// trusted proxies only, and the network of the connection
 func getRemoteAddressFromGinContext(c *gin.Context) (ip, port, netType string) {
-	ip, port = getRemoteAddressSet(c)
-	// no ip and port were passed through gateway
-
-	if len(ip) < 1 {
-		ip, port, netType = "0.0.0.0", "0", ""
-		if peer, ok := peer.FromContext(c.Request.Context()); ok {
-			netType = peer.Addr.Network()
-			// Here is the tricky part
-			// We only try to parse IPV4 style Address
-			// Rest of peer.Addr implementations are not well formatted string
-			// and in this case, we leave port as zero and IP as the returned
-			// String from Addr.String() function
-			//
-			// BTW, just skip the error since it would not impact anything
-			// Operators could observe this error from monitor dashboards by
-			// validating existence of IP & PORT fields
-			ip, port, _ = net.SplitHostPort(peer.Addr.String())
-		}
-
-		forwardedRemoteIP := c.Request.Header.Get("x-forwarded-for")
-
-		// Deal with forwarded remote ip
-		if len(forwardedRemoteIP) > 0 {
-			if forwardedRemoteIP == "::1" {
-				forwardedRemoteIP = "localhost"
-			}
-
-			ip = forwardedRemoteIP
-		}
-
-		if ip == "::1" {
-			ip = "localhost"
-		}
+	client, ok := realip.FromContext(c.Request.Context())
+	if !ok {
+		client, ok = realip.DefaultResolver.ResolveRequest(c.Request)
 	}
-
-	return ip, port, netType
-}
-
-func getRemoteAddressSet(c *gin.Context) (ip, port string) {
-	if v := c.Request.Header.Get("x-forwarded-remote-addr"); len(v) > 0 {
-		ip, port, _ = net.SplitHostPort(v)
+	if _, _, err := net.SplitHostPort(c.Request.RemoteAddr); err == nil {
+		netType = "tcp"
 	}
-
-	if ip == "::1" {
-		ip = "localhost"
-	}
-
-	return ip, port
+	ip, port = clientAddress(client, ok)
+	return ip, port, netType
 }
@@ -2,10 +2,12 @@ package logger
 
 import (
 	"context"
-	"net"
 	"path"
+	"strings"
 	"time"
 
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/karthikraman22/rpc-bp/realip"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
@@ -32,13 +34,17 @@ func UnaryServerInterceptor(log Logger) grpc.UnaryServerInterceptor {
 		start := time.Now()
 
 		md, _ := metadata.FromIncomingContext(ctx)
-		peer_ip, peer_port, scheme := getRemoteAddressFromMetaData(md, ctx)
+		peer_ip, peer_port, scheme := getRemoteAddressFromMetaData(ctx)
 		service := path.Dir(info.FullMethod)[1:]
 		method := path.Base(info.FullMethod)
 
-		correlationId := md[CORRELATION_ID.String()]
+		correlationId := incomingCorrelationID(md)
+		tc := incomingTraceContext(md).withSpan(ctx)
+		log := withGwInfo(log, md)
 
-		newCtx := context.WithValue(ctx, CORRELATION_ID, correlationId)
+		newCtx := WithTraceContext(WithCorrelationID(ctx, correlationId), tc)
+		// Echo the correlation id in the response header metadata
+		_ = grpc.SetHeader(ctx, metadata.Pairs(CORRELATION_ID.String(), correlationId))
 
 		// Calls the handler
 		resp, err := handler(newCtx, req)
@@ -47,67 +53,109 @@ func UnaryServerInterceptor(log Logger) grpc.UnaryServerInterceptor {
 		code := status.Code(err)
 
 		if err != nil {
-			log.Info("failed", CORRELATION_ID.String(), correlationId, "meta", md, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme, "error", err)
+			log.Info("failed", CORRELATION_ID.String(), correlationId, "trace_id", tc.TraceID, "span_id", tc.SpanID, "meta", md, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme, "error", err)
 		} else {
-			log.Info("success", CORRELATION_ID.String(), correlationId, "meta", md, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme)
+			log.Info("success", CORRELATION_ID.String(), correlationId, "trace_id", tc.TraceID, "span_id", tc.SpanID, "meta", md, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme)
 		}
 
 		return resp, err
 	}
 }
 
-func getRemoteAddressFromMetaData(md metadata.MD, ctx context.Context) (ip, port, netType string) {
-	ip, port = getRemoteAddressSetFromMeta(md)
-	// no ip and port were passed through gateway
-
-	if len(ip) < 1 {
-		ip, port, netType = "0.0.0.0", "0", ""
-		if peer, ok := peer.FromContext(ctx); ok {
-			netType = peer.Addr.Network()
-			// Here is the tricky part
-			// We only try to parse IPV4 style Address
-			// Rest of peer.Addr implementations are not well formatted string
-			// and in this case, we leave port as zero and IP as the returned
-			// String from Addr.String() function
-			//
-			// BTW, just skip the error since it would not impact anything
-			// Operators could observe this error from monitor dashboards by
-			// validating existence of IP & PORT fields
-			ip, port, _ = net.SplitHostPort(peer.Addr.String())
-		}
+// Stream server interceptor
+func StreamServerInterceptor(log Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := stream.Context()
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		peer_ip, peer_port, scheme := getRemoteAddressFromMetaData(ctx)
+		service := path.Dir(info.FullMethod)[1:]
+		method := path.Base(info.FullMethod)
+
+		correlationId := incomingCorrelationID(md)
+		tc := incomingTraceContext(md).withSpan(ctx)
+		log := withGwInfo(log, md)
 
-		forwardedRemoteIPList := md["x-forwarded-for"]
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = WithTraceContext(WithCorrelationID(ctx, correlationId), tc)
+		// Echo the correlation id in the response header metadata
+		_ = stream.SetHeader(metadata.Pairs(CORRELATION_ID.String(), correlationId))
 
-		// Deal with forwarded remote ip
-		if len(forwardedRemoteIPList) > 0 {
-			forwardedRemoteIP := forwardedRemoteIPList[0]
-			if forwardedRemoteIP == "::1" {
-				forwardedRemoteIP = "localhost"
-			}
+		// Calls the handler
+		err := handler(srv, wrapped)
+
+		duration := durationToMilliseconds(time.Since(start))
+		code := status.Code(err)
 
-			ip = forwardedRemoteIP
+		if err != nil {
+			log.Info("failed", CORRELATION_ID.String(), correlationId, "trace_id", tc.TraceID, "span_id", tc.SpanID, "meta", md, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme, "error", err)
+		} else {
+			log.Info("success", CORRELATION_ID.String(), correlationId, "trace_id", tc.TraceID, "span_id", tc.SpanID, "meta", md, "duration_ms", duration, "code", code, "service", service, "method", method, "raddr", (peer_ip + ":" + peer_port), "scheme", scheme)
 		}
 
-		if ip == "::1" {
-			ip = "localhost"
+		return err
+	}
+}
+
+// incomingCorrelationID takes the correlation id from the metadata or generates a new one
+func incomingCorrelationID(md metadata.MD) string {
+	if v := md.Get(CORRELATION_ID.String()); len(v) > 0 {
+		return CorrelationIDOrNew(v[0])
+	}
+	return NewCorrelationID()
+}
+
+// incomingTraceContext continues the W3C trace context of the metadata or starts a new one
+func incomingTraceContext(md metadata.MD) TraceContext {
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
 		}
+		return ""
 	}
+	return NewTraceContext(first(TraceparentHeader), strings.Join(md.Get(TracestateHeader), ","), strings.Join(md.Get(BaggageHeader), ","))
+}
 
+// getRemoteAddressFromMetaData returns the client resolved by realip, behind
+// trusted proxies only, and the network of the connection
+func getRemoteAddressFromMetaData(ctx context.Context) (ip, port, netType string) {
+	if peer, ok := peer.FromContext(ctx); ok {
+		netType = peer.Addr.Network()
+	}
+	client, ok := realip.FromContext(ctx)
+	if !ok {
+		client, ok = realip.DefaultResolver.ResolveGrpc(ctx)
+	}
+	ip, port = clientAddress(client, ok)
 	return ip, port, netType
 }
 
-func getRemoteAddressSetFromMeta(md metadata.MD) (ip, port string) {
-	if v := md.Get("x-forwarded-remote-addr"); len(v) > 0 {
-		ip, port, _ = net.SplitHostPort(v[0])
+// clientAddress formats the client for the raddr field, 0.0.0.0:0 if unknown
+func clientAddress(client realip.Client, ok bool) (ip, port string) {
+	if !ok {
+		return "0.0.0.0", "0"
 	}
-
+	ip, port = client.IP.String(), client.Port
 	if ip == "::1" {
 		ip = "localhost"
 	}
-
+	if port == "" {
+		port = "0"
+	}
 	return ip, port
 }
 
+// withGwInfo adds the original REST request of calls forwarded by the grpc-gateway to every line
+func withGwInfo(log Logger, md metadata.MD) Logger {
+	gwMethod, gwPath, gwScheme, gwUserAgent := getGwInfo(md)
+	zl, ok := log.(*zapLogger)
+	if !ok || gwMethod == "" {
+		return log
+	}
+	return zl.with("gw_method", gwMethod, "gw_path", gwPath, "gw_scheme", gwScheme, "gw_user_agent", gwUserAgent)
+}
+
 // GetGwInfo Extract gateway related information from metadata.
 func getGwInfo(md metadata.MD) (gwMethod, gwPath, gwScheme, gwUserAgent string) {
 	gwMethod, gwPath, gwScheme, gwUserAgent = "", "", "", ""
@@ -1,9 +1,13 @@
 package logger
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"sync"
+	"syscall"
 
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
@@ -122,3 +126,39 @@ func getLoggers() map[string]Logger {
 
 	return l
 }
+
+// ForContext returns a logger adding the correlation id and trace context of
+// the request ctx belongs to to every line.
+func ForContext(log Logger, ctx context.Context) Logger {
+	zl, ok := log.(*zapLogger)
+	if !ok {
+		return log
+	}
+	fields := []interface{}{}
+	if id := CorrelationID(ctx); id != "" {
+		fields = append(fields, CORRELATION_ID.String(), id)
+	}
+	if tc, ok := TraceContextFromContext(ctx); ok {
+		fields = append(fields, "trace_id", tc.TraceID, "span_id", tc.SpanID)
+	}
+	if len(fields) == 0 {
+		return log
+	}
+	return zl.with(fields...)
+}
+
+// Sync flushes the buffered lines of all loggers
+func Sync() error {
+	var errs error
+	for _, l := range getLoggers() {
+		zl, ok := l.(*zapLogger)
+		if !ok {
+			continue
+		}
+		// Syncing a console or pipe is not supported and not needed
+		if err := zl.logger.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+			errs = multierr.Append(errs, err)
+		}
+	}
+	return errs
+}
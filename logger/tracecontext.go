@@ -0,0 +1,160 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+	// W3C Baggage header, see https://www.w3.org/TR/baggage/
+	BaggageHeader = "baggage"
+
+	traceparentVersion = "00"
+	// sampled is the only trace flag defined by version 00
+	flagSampled byte = 0x01
+)
+
+type traceContextKey struct{}
+
+// TraceContext is the W3C trace context of a request handled by this process
+type TraceContext struct {
+	// TraceID is the 32 hex character id of the whole trace
+	TraceID string
+	// SpanID is the 16 hex character id of the span of this process
+	SpanID string
+	// ParentSpanID is the span id of the caller, empty if this process started the trace
+	ParentSpanID string
+	// Flags are the trace flags, only the sampled flag is defined
+	Flags byte
+	// State is the vendor specific tracestate, passed on unchanged
+	State string
+	// Baggage is the raw baggage header, passed on unchanged
+	Baggage string
+}
+
+// NewTraceContext continues the trace described by the incoming headers or
+// starts a new one. A new span id is generated in both cases.
+func NewTraceContext(traceparent, tracestate, baggage string) TraceContext {
+	tc := TraceContext{SpanID: randomHex(8)}
+	if traceID, parentID, flags, ok := parseTraceparent(traceparent); ok {
+		tc.TraceID, tc.ParentSpanID, tc.Flags = traceID, parentID, flags
+		tc.State = strings.TrimSpace(tracestate)
+	} else {
+		tc.TraceID, tc.Flags = randomHex(16), flagSampled
+	}
+	if _, ok := ParseBaggage(baggage); ok {
+		tc.Baggage = strings.TrimSpace(baggage)
+	}
+	return tc
+}
+
+// withSpan takes the ids of the local OpenTelemetry span of ctx, if tracing is enabled,
+// so log lines match the exported spans
+func (tc TraceContext) withSpan(ctx context.Context) TraceContext {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || sc.IsRemote() {
+		return tc
+	}
+	tc.TraceID, tc.SpanID, tc.Flags = sc.TraceID().String(), sc.SpanID().String(), byte(sc.TraceFlags())
+	if ts := sc.TraceState().String(); ts != "" {
+		tc.State = ts
+	}
+	return tc
+}
+
+// Traceparent formats the traceparent header for calls made by this span
+func (tc TraceContext) Traceparent() string {
+	return traceparentVersion + "-" + tc.TraceID + "-" + tc.SpanID + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// Sampled reports whether the caller recorded the trace
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&flagSampled != 0
+}
+
+// IsValid reports whether tc holds a trace and span id
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != "" && tc.SpanID != ""
+}
+
+// WithTraceContext returns a copy of ctx carrying the trace context
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the trace context of the request ctx belongs to
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// ParseBaggage decodes a baggage header into its key value pairs, properties are dropped
+func ParseBaggage(baggage string) (map[string]string, bool) {
+	baggage = strings.TrimSpace(baggage)
+	if baggage == "" {
+		return nil, false
+	}
+	members := map[string]string{}
+	for _, member := range strings.Split(baggage, ",") {
+		kv := strings.SplitN(strings.SplitN(member, ";", 2)[0], "=", 2)
+		if len(kv) != 2 {
+			return nil, false
+		}
+		key := strings.TrimSpace(kv[0])
+		value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if key == "" || err != nil {
+			return nil, false
+		}
+		members[key] = value
+	}
+	return members, true
+}
+
+// parseTraceparent validates a version 00 traceparent header
+func parseTraceparent(s string) (traceID, parentID string, flags byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", 0, false
+	}
+	// Version 00 has exactly four fields, future versions may append more
+	if parts[0] == traceparentVersion && len(parts) != 4 {
+		return "", "", 0, false
+	}
+	traceID, parentID = parts[1], parts[2]
+	if !isLowerHex(traceID, 32) || !isLowerHex(parentID, 16) || !isLowerHex(parts[3], 2) {
+		return "", "", 0, false
+	}
+	if traceID == strings.Repeat("0", 32) || parentID == strings.Repeat("0", 16) {
+		return "", "", 0, false
+	}
+	f, _ := hex.DecodeString(parts[3])
+	return traceID, parentID, f[0], true
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate trace id: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,29 @@
+package logger
+
+import "testing"
+
+func TestNewTraceContext(t *testing.T) {
+	tc := NewTraceContext("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "congo=t61rcWkgMzE", "userId=alice%20b,serverNode=DF28;prop")
+	if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.ParentSpanID != "00f067aa0ba902b7" || !tc.Sampled() {
+		t.Fatalf("unexpected trace context %+v", tc)
+	}
+	if tc.SpanID == tc.ParentSpanID || len(tc.SpanID) != 16 {
+		t.Fatalf("span id %q not regenerated", tc.SpanID)
+	}
+	if tc.State != "congo=t61rcWkgMzE" {
+		t.Fatalf("tracestate %q", tc.State)
+	}
+	if b, _ := ParseBaggage(tc.Baggage); b["userId"] != "alice b" || b["serverNode"] != "DF28" {
+		t.Fatalf("baggage %v", b)
+	}
+	if got := tc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-"+tc.SpanID+"-01" {
+		t.Fatalf("traceparent %q", got)
+	}
+
+	for _, invalid := range []string{"", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"} {
+		tc := NewTraceContext(invalid, "congo=t61rcWkgMzE", "")
+		if tc.ParentSpanID != "" || tc.State != "" || len(tc.TraceID) != 32 {
+			t.Fatalf("%q: expected a new trace, got %+v", invalid, tc)
+		}
+	}
+}
@@ -34,6 +34,11 @@ func newZapLogger(name string) *zapLogger {
 	return newZapLoggerWithOptions(name, zap.AddCaller(), zap.AddCallerSkip(1))
 }
 
+// with returns a child logger adding the key value pairs to every line
+func (zl *zapLogger) with(keysAndValues ...interface{}) *zapLogger {
+	return &zapLogger{name: zl.name, logger: zl.logger.With(zl.handleFields(keysAndValues)...)}
+}
+
 // Info logs a message at level Info.
 func (zl *zapLogger) Info(msg string, keysAndValues ...interface{}) {
 	if checkedEntry := zl.logger.Check(zap.InfoLevel, msg); checkedEntry != nil {
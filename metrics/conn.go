@@ -0,0 +1,38 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	connsOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "conn",
+		Name:      "open",
+		Help:      "Number of connections currently open on a limited listener of the server.",
+	}, []string{"server"})
+
+	connsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "conn",
+		Name:      "rejected_total",
+		Help:      "Total number of connections rejected by a connection limit of the server.",
+	}, []string{"server", "reason"})
+)
+
+func init() {
+	Registry.MustRegister(connsOpen, connsRejected)
+}
+
+// ConnOpened counts a connection accepted by server
+func ConnOpened(server string) {
+	connsOpen.WithLabelValues(server).Inc()
+}
+
+// ConnClosed counts a connection of server closed
+func ConnClosed(server string) {
+	connsOpen.WithLabelValues(server).Dec()
+}
+
+// ConnRejected counts a connection server rejected because of the limit reason
+func ConnRejected(server, reason string) {
+	connsRejected.WithLabelValues(server, reason).Inc()
+}
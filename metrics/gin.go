@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unmatchedRoute labels requests not matching any route, so arbitrary paths do not create new series
+const unmatchedRoute = "<unmatched>"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests completed by the server.",
+	}, []string{"server", "method", "route", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests handled by the server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server", "method", "route", "code"})
+
+	httpInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently handled by the server.",
+	}, []string{"server"})
+)
+
+func init() {
+	Registry.MustRegister(httpRequests, httpDuration, httpInFlight)
+}
+
+// GinMiddleware records count, latency and in-flight requests of the server.
+// Requests are labeled by their route template (c.FullPath), not the request uri.
+func GinMiddleware(server string) gin.HandlerFunc {
+	inFlight := httpInFlight.WithLabelValues(server)
+	return func(c *gin.Context) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		code := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(server, c.Request.Method, route, code).Inc()
+		httpDuration.WithLabelValues(server, c.Request.Method, route, code).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGinMiddlewareRouteLabel(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(GinMiddleware("gin-test"))
+	router.GET("/items/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	item := httpRequests.WithLabelValues("gin-test", http.MethodGet, "/items/:id", "200")
+	unmatched := httpRequests.WithLabelValues("gin-test", http.MethodGet, unmatchedRoute, "404")
+	itemBefore, unmatchedBefore := testutil.ToFloat64(item), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/items/1", "/items/2", "/nope/1", "/nope/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(item) - itemBefore; got != 2 {
+		t.Fatalf("/items/:id: got %v requests, want 2", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - unmatchedBefore; got != 2 {
+		t.Fatalf("%s: got %v requests, want 2", unmatchedRoute, got)
+	}
+	// One series per route template, not per path
+	if n := testutil.CollectAndCount(httpRequests); n != 2 {
+		t.Fatalf("got %d series, want 2", n)
+	}
+	if got := testutil.ToFloat64(httpInFlight.WithLabelValues("gin-test")); got != 0 {
+		t.Fatalf("got %v requests in flight", got)
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	unary  = "unary"
+	stream = "stream"
+)
+
+var (
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "Total number of RPCs completed by the server.",
+	}, []string{"type", "service", "method", "code"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of RPCs handled by the server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type", "service", "method", "code"})
+
+	grpcInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "requests_in_flight",
+		Help:      "Number of RPCs currently handled by the server.",
+	}, []string{"type", "service", "method"})
+)
+
+func init() {
+	Registry.MustRegister(grpcRequests, grpcDuration, grpcInFlight)
+}
+
+// UnaryServerInterceptor records count, latency and in-flight unary RPCs
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done := observeRPC(unary, info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records count, latency and in-flight streaming RPCs
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := observeRPC(stream, info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+func observeRPC(rpcType, fullMethod string) func(error) {
+	service, method := path.Dir(fullMethod)[1:], path.Base(fullMethod)
+	start := time.Now()
+	inFlight := grpcInFlight.WithLabelValues(rpcType, service, method)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		code := status.Code(err).String()
+		grpcRequests.WithLabelValues(rpcType, service, method, code).Inc()
+		grpcDuration.WithLabelValues(rpcType, service, method, code).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/rpcbp.test.Items/Get"}
+	notFound := grpcRequests.WithLabelValues(unary, "rpcbp.test.Items", "Get", codes.NotFound.String())
+	before := testutil.ToFloat64(notFound)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if got := testutil.ToFloat64(grpcInFlight.WithLabelValues(unary, "rpcbp.test.Items", "Get")); got != 1 {
+			t.Errorf("got %v rpcs in flight, want 1", got)
+		}
+		return nil, status.Error(codes.NotFound, "no such item")
+	}
+	if _, err := UnaryServerInterceptor()(context.Background(), nil, info, handler); status.Code(err) != codes.NotFound {
+		t.Fatalf("got %v", err)
+	}
+
+	if got := testutil.ToFloat64(notFound) - before; got != 1 {
+		t.Fatalf("got %v requests, want 1", got)
+	}
+	if got := testutil.ToFloat64(grpcInFlight.WithLabelValues(unary, "rpcbp.test.Items", "Get")); got != 0 {
+		t.Fatalf("got %v rpcs in flight", got)
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// Path the metrics are exposed on
+	Path = "/metrics"
+
+	namespace = "rpcbp"
+)
+
+// Registry holds all metrics of rpc-bp, including the Go runtime and process collectors.
+// Applications may register their own collectors with it.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics of Registry in the prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(Registry, promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+// ListenAndServe exposes the metrics on a dedicated listener, for processes without a RestServer
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler())
+	return http.ListenAndServe(addr, mux)
+}
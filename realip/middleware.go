@@ -0,0 +1,42 @@
+package realip
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor resolves the client of gRPC calls into their ctx
+func UnaryServerInterceptor(r *Resolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if client, ok := r.ResolveGrpc(ctx); ok {
+			ctx = WithClient(ctx, client)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor resolves the client of gRPC streams into their ctx
+func StreamServerInterceptor(r *Resolver) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		client, ok := r.ResolveGrpc(stream.Context())
+		if !ok {
+			return handler(srv, stream)
+		}
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = WithClient(stream.Context(), client)
+		return handler(srv, wrapped)
+	}
+}
+
+// GinMiddleware resolves the client of REST requests into the request ctx
+func GinMiddleware(r *Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if client, ok := r.ResolveRequest(c.Request); ok {
+			c.Request = c.Request.WithContext(WithClient(c.Request.Context(), client))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,196 @@
+// Package realip resolves the IP of the client behind trusted proxies. Only
+// proxies listed as trusted may tell the client address through the
+// x-forwarded-for and x-forwarded-remote-addr headers, so clients cannot
+// spoof it.
+package realip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// Proxies append the address they received the request from
+	ForwardedForHeader = "x-forwarded-for"
+	// Address of the REST request, set by the grpc-gateway of the server package
+	ForwardedRemoteAddrHeader = "x-forwarded-remote-addr"
+)
+
+// Peers on the same host are always trusted
+var loopback, _ = ParseCIDRs("127.0.0.0/8", "::1")
+
+// DefaultResolver trusts the peers on the same host only
+var DefaultResolver = NewResolver()
+
+// Client is the resolved client of a request
+type Client struct {
+	IP net.IP
+	// Port is empty if a proxy only forwarded the IP
+	Port string
+}
+
+// String formats the client as ip:port, or just the IP without port
+func (c Client) String() string {
+	if c.Port == "" {
+		return c.IP.String()
+	}
+	return net.JoinHostPort(c.IP.String(), c.Port)
+}
+
+// Resolver finds the client of a request behind trusted proxies
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver returns a Resolver trusting the proxies in the trusted
+// networks. Loopback, unix socket and in-process peers are trusted as well,
+// e.g. the grpc-gateway forwarding REST requests to the gRPC server.
+func NewResolver(trusted ...*net.IPNet) *Resolver {
+	return &Resolver{trusted: append(append([]*net.IPNet{}, loopback...), trusted...)}
+}
+
+// Trusted returns the trusted networks
+func (r *Resolver) Trusted() []*net.IPNet {
+	return r.trusted
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve walks the proxies from the peer of the connection backwards and
+// returns the first untrusted one, which is the client. remote is the
+// address of the connection, remoteAddr the x-forwarded-remote-addr and
+// forwarded the x-forwarded-for values. If every hop is trusted the first
+// one is the client. ok is false if no hop has an IP.
+func (r *Resolver) Resolve(remote, remoteAddr string, forwarded []string) (client Client, ok bool) {
+	client, ok = parseHop(remote)
+	// Not an IP, the peer is on this host: a unix socket or in-process
+	local := !ok
+	if !local && !r.isTrusted(client.IP) {
+		return client, true
+	}
+
+	hops := forwardedHops(forwarded)
+	if c, ok := parseHop(remoteAddr); ok {
+		// The grpc-gateway forwards the address of the REST request both ways
+		if len(hops) > 0 && hops[len(hops)-1].IP.Equal(c.IP) {
+			hops = hops[:len(hops)-1]
+		}
+		hops = append(hops, c)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i].IP == nil {
+			// Garbage in the header, the hops before it cannot be trusted
+			break
+		}
+		client, ok = hops[i], true
+		if !r.isTrusted(client.IP) {
+			break
+		}
+	}
+	return client, ok
+}
+
+// ResolveGrpc resolves the client of a gRPC call
+func (r *Resolver) ResolveGrpc(ctx context.Context) (Client, bool) {
+	remote := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	remoteAddr := ""
+	// The value set by the proxy closest to us is the last one
+	if v := md.Get(ForwardedRemoteAddrHeader); len(v) > 0 {
+		remoteAddr = v[len(v)-1]
+	}
+	return r.Resolve(remote, remoteAddr, md.Get(ForwardedForHeader))
+}
+
+// ResolveRequest resolves the client of a REST request
+func (r *Resolver) ResolveRequest(req *http.Request) (Client, bool) {
+	remoteAddr := ""
+	if v := req.Header.Values(ForwardedRemoteAddrHeader); len(v) > 0 {
+		remoteAddr = v[len(v)-1]
+	}
+	return r.Resolve(req.RemoteAddr, remoteAddr, req.Header.Values(ForwardedForHeader))
+}
+
+// parseHop parses an address with or without port
+func parseHop(addr string) (Client, bool) {
+	addr = strings.TrimSpace(addr)
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return Client{IP: ip, Port: port}, true
+		}
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		return Client{IP: ip}, true
+	}
+	return Client{}, false
+}
+
+// forwardedHops splits the x-forwarded-for values into hops, the proxy closest to us last
+func forwardedHops(forwarded []string) []Client {
+	var hops []Client
+	for _, v := range forwarded {
+		for _, addr := range strings.Split(v, ",") {
+			if strings.TrimSpace(addr) == "" {
+				continue
+			}
+			hop, _ := parseHop(addr)
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx carrying the client
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// FromContext returns the client of the request ctx belongs to, resolved by
+// the interceptors or the gin middleware of this package
+func FromContext(ctx context.Context) (Client, bool) {
+	client, ok := ctx.Value(clientKey{}).(Client)
+	return client, ok
+}
+
+// ParseCIDRs parses CIDRs like 10.0.0.0/8, a plain IP is a single address
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,52 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8", "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver(trusted...)
+
+	for _, tc := range []struct {
+		name, remote, remoteAddr string
+		forwarded                []string
+		want                     string
+	}{
+		{"direct", "203.0.113.7:4711", "", nil, "203.0.113.7:4711"},
+		{"spoofed by untrusted peer", "203.0.113.7:4711", "198.51.100.1:1", []string{"198.51.100.1"}, "203.0.113.7:4711"},
+		{"behind trusted proxy", "10.0.0.2:4711", "", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"multi hop", "10.0.0.2:4711", "", []string{"198.51.100.1, 203.0.113.7", "10.0.0.3"}, "203.0.113.7"},
+		{"all trusted", "10.0.0.2:4711", "", []string{"10.0.0.4, 10.0.0.3"}, "10.0.0.4"},
+		{"garbage hop", "10.0.0.2:4711", "", []string{"198.51.100.1, nope, 10.0.0.3"}, "10.0.0.3"},
+		{"ipv6 proxy", "[2001:db8::1]:443", "", []string{"[2001:db8::7]:4711"}, "[2001:db8::7]:4711"},
+		{"gateway", "127.0.0.1:50000", "203.0.113.7:4711", []string{"203.0.113.7"}, "203.0.113.7:4711"},
+		{"gateway behind proxy", "127.0.0.1:50000", "10.0.0.2:4711", []string{"203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"unix socket", "@", "", []string{"203.0.113.7"}, "203.0.113.7"},
+	} {
+		got, ok := r.Resolve(tc.remote, tc.remoteAddr, tc.forwarded)
+		if !ok || got.String() != tc.want {
+			t.Errorf("%s: got %s, %v, want %s", tc.name, got, ok, tc.want)
+		}
+	}
+
+	if _, ok := r.Resolve("@", "", nil); ok {
+		t.Error("resolved a client without any IP")
+	}
+}
+
+func TestResolveRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1")
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+
+	got, ok := DefaultResolver.ResolveRequest(req)
+	if !ok || got.String() != "203.0.113.7" {
+		t.Fatalf("got %s, %v", got, ok)
+	}
+}
@@ -0,0 +1,102 @@
+package security
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/google/tink/go/keyset"
+	"github.com/google/tink/go/prf"
+)
+
+// blindIndexSize is the length in bytes of a blind index
+const blindIndexSize = 16
+
+// BlindIndexer computes deterministic keyed hashes of plaintext values so
+// encrypted columns can still be queried for equality
+type BlindIndexer struct {
+	set *prf.Set
+}
+
+// BlindIndex is the blind index of a value, stored in a companion column of an encrypted field
+type BlindIndex []byte
+
+// NewBlindIndexer returns a BlindIndexer using the cleartext binary PRF keyset at path
+func NewBlindIndexer(path string) (*BlindIndexer, error) {
+	handle, err := ReadKeysetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlindIndexerFromHandle(handle)
+}
+
+// NewBlindIndexerFromHandle returns a BlindIndexer using the given PRF keyset handle
+func NewBlindIndexerFromHandle(handle *keyset.Handle) (*BlindIndexer, error) {
+	set, err := prf.NewPRFSet(handle)
+	if err != nil {
+		return nil, fmt.Errorf("security: blind index keyset: %w", err)
+	}
+	return &BlindIndexer{set: set}, nil
+}
+
+// GenerateBlindIndexKeysetFile creates a new HMAC-SHA256 PRF keyset and stores it at path
+func GenerateBlindIndexKeysetFile(path string) error {
+	handle, err := keyset.NewHandle(prf.HMACSHA256PRFKeyTemplate())
+	if err != nil {
+		return err
+	}
+	return WriteKeysetFile(handle, path)
+}
+
+// Index computes the blind index of value with the primary key
+func (b *BlindIndexer) Index(value string) (BlindIndex, error) {
+	return b.set.ComputePrimaryPRF([]byte(value), blindIndexSize)
+}
+
+// Candidates computes the blind index of value with every key of the keyset.
+// During a rotation of the blind index key lookups should match any of them.
+func (b *BlindIndexer) Candidates(value string) ([]BlindIndex, error) {
+	out := make([]BlindIndex, 0, len(b.set.PRFs))
+	for _, p := range b.set.PRFs {
+		idx, err := p.ComputePRF([]byte(value), blindIndexSize)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, idx)
+	}
+	return out, nil
+}
+
+// NewBlindIndex computes the blind index of value with the default BlindIndexer
+func NewBlindIndex(value string) (BlindIndex, error) {
+	b := DefaultBlindIndexer()
+	if b == nil {
+		return nil, ErrNoBlindIndexer
+	}
+	return b.Index(value)
+}
+
+// Value implements driver.Valuer
+func (b BlindIndex) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	return []byte(b), nil
+}
+
+// Scan implements sql.Scanner
+func (b *BlindIndex) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*b = nil
+	case []byte:
+		*b = append((*b)[:0], v...)
+	default:
+		return fmt.Errorf("security: cannot scan %T into BlindIndex", src)
+	}
+	return nil
+}
+
+// GormDataType implements schema.GormDataTypeInterface
+func (BlindIndex) GormDataType() string {
+	return "bytes"
+}
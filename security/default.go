@@ -0,0 +1,49 @@
+package security
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNoKMS is returned by the column types if no default KMS is registered
+	ErrNoKMS = errors.New("security: no default kms registered")
+	// ErrNoBlindIndexer is returned if no default BlindIndexer is registered
+	ErrNoBlindIndexer = errors.New("security: no default blind indexer registered")
+)
+
+// defaults are used by the column types, which are created by the sql
+// driver and have no other way of reaching a KMS
+var defaults struct {
+	sync.RWMutex
+	kms     *KMS
+	indexer *BlindIndexer
+}
+
+// SetDefaultKMS registers the KMS used by EncryptedString and EncryptedJSON
+func SetDefaultKMS(k *KMS) {
+	defaults.Lock()
+	defer defaults.Unlock()
+	defaults.kms = k
+}
+
+// DefaultKMS returns the registered KMS or nil
+func DefaultKMS() *KMS {
+	defaults.RLock()
+	defer defaults.RUnlock()
+	return defaults.kms
+}
+
+// SetDefaultBlindIndexer registers the BlindIndexer used by NewBlindIndex
+func SetDefaultBlindIndexer(b *BlindIndexer) {
+	defaults.Lock()
+	defer defaults.Unlock()
+	defaults.indexer = b
+}
+
+// DefaultBlindIndexer returns the registered BlindIndexer or nil
+func DefaultBlindIndexer() *BlindIndexer {
+	defaults.RLock()
+	defer defaults.RUnlock()
+	return defaults.indexer
+}
@@ -1 +1,262 @@
 package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/insecurecleartextkeyset"
+	"github.com/google/tink/go/keyset"
+	"github.com/google/tink/go/tink"
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+const (
+	// envelopeVersion is the first byte of every ciphertext produced by KMS.Encrypt
+	envelopeVersion byte = 1
+	// envelopeHeaderSize is the version byte followed by the 4 byte wrapped key length
+	envelopeHeaderSize = 5
+)
+
+var (
+	// ErrInvalidCiphertext is returned when a ciphertext is not a KMS envelope
+	ErrInvalidCiphertext = errors.New("security: invalid envelope ciphertext")
+)
+
+// KMS implements envelope encryption. Every record is encrypted with its own
+// data encryption key (DEK), which is in turn wrapped by the key encryption key (KEK).
+type KMS struct {
+	// Guards kek and primaryID, which are swapped on Reload
+	mu sync.RWMutex
+	// AEAD primitive of the key encryption key
+	kek tink.AEAD
+	// Id of the primary KEK version, 0 if versions are managed by the provider
+	primaryID uint32
+	// Source of the key encryption key, nil if created from a fixed primitive
+	provider Provider
+	// Logger interface
+	log logger.Logger
+}
+
+// DataKey is a per-record data encryption key
+type DataKey struct {
+	// AEAD primitive of the data key
+	primitive tink.AEAD
+	// Wrapped holds the data key encrypted under the KEK, safe to persist
+	Wrapped []byte
+}
+
+// NewKMS returns a KMS using the cleartext binary AEAD keyset at kekPath as the KEK
+func NewKMS(kekPath string) (*KMS, error) {
+	return NewKMSWithProvider(NewFileProvider(kekPath))
+}
+
+// NewKMSWithProvider returns a KMS taking the KEK from provider
+func NewKMSWithProvider(provider Provider) (*KMS, error) {
+	k := &KMS{provider: provider, log: logger.WithName("kms")}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	k.log.Info("kek loaded", "provider", provider.Name(), "primary_key_id", k.primaryID)
+	return k, nil
+}
+
+// NewKMSFromHandle returns a KMS using the given keyset handle as the KEK
+func NewKMSFromHandle(handle *keyset.Handle) (*KMS, error) {
+	kek, err := aead.New(handle)
+	if err != nil {
+		return nil, err
+	}
+	k := NewKMSWithAEAD(kek)
+	k.primaryID = handle.KeysetInfo().GetPrimaryKeyId()
+	return k, nil
+}
+
+// NewKMSWithAEAD returns a KMS using an arbitrary AEAD primitive as the KEK
+func NewKMSWithAEAD(kek tink.AEAD) *KMS {
+	return &KMS{kek: kek, log: logger.WithName("kms")}
+}
+
+// Reload fetches the KEK from the provider again so key versions added or
+// promoted by a rotation take effect without restarting the process
+func (k *KMS) Reload() error {
+	if k.provider == nil {
+		return errors.New("security: kms has no kek provider")
+	}
+	if err := k.load(); err != nil {
+		return err
+	}
+	k.log.Info("kek reloaded", "provider", k.provider.Name(), "primary_key_id", k.PrimaryKeyID())
+	return nil
+}
+
+// PrimaryKeyID returns the id of the primary KEK version, or 0 if unknown
+func (k *KMS) PrimaryKeyID() uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primaryID
+}
+
+func (k *KMS) load() error {
+	kek, primaryID, err := k.provider.KEK()
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.kek, k.primaryID = kek, primaryID
+	k.mu.Unlock()
+	return nil
+}
+
+func (k *KMS) aead() tink.AEAD {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.kek
+}
+
+// ReadKeysetFile reads a cleartext binary keyset from the file system
+func ReadKeysetFile(path string) (*keyset.Handle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return insecurecleartextkeyset.Read(keyset.NewBinaryReader(f))
+}
+
+// WriteKeysetFile writes the keyset as a cleartext binary keyset to the file system.
+// The file is replaced atomically so running processes never read a partial keyset.
+func WriteKeysetFile(handle *keyset.Handle, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := insecurecleartextkeyset.Write(handle, keyset.NewBinaryWriter(f)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// GenerateKeysetFile creates a new AES256-GCM keyset and stores it at path
+func GenerateKeysetFile(path string) error {
+	handle, err := keyset.NewHandle(aead.AES256GCMKeyTemplate())
+	if err != nil {
+		return err
+	}
+	return WriteKeysetFile(handle, path)
+}
+
+// GenerateDataKey creates a fresh data key wrapped by the KEK
+func (k *KMS) GenerateDataKey() (*DataKey, error) {
+	handle, err := keyset.NewHandle(aead.AES256GCMKeyTemplate())
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := k.WrapKey(handle)
+	if err != nil {
+		return nil, err
+	}
+	primitive, err := aead.New(handle)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{primitive: primitive, Wrapped: wrapped}, nil
+}
+
+// WrapKey encrypts a data keyset with the KEK
+func (k *KMS) WrapKey(handle *keyset.Handle) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := handle.Write(keyset.NewBinaryWriter(buf), k.aead()); err != nil {
+		return nil, fmt.Errorf("security: wrap data key: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnwrapKey decrypts a data keyset previously wrapped with WrapKey
+func (k *KMS) UnwrapKey(wrapped []byte) (*keyset.Handle, error) {
+	handle, err := keyset.Read(keyset.NewBinaryReader(bytes.NewReader(wrapped)), k.aead())
+	if err != nil {
+		return nil, fmt.Errorf("security: unwrap data key: %w", err)
+	}
+	return handle, nil
+}
+
+// UnwrapDataKey restores a DataKey from its wrapped form
+func (k *KMS) UnwrapDataKey(wrapped []byte) (*DataKey, error) {
+	handle, err := k.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	primitive, err := aead.New(handle)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{primitive: primitive, Wrapped: wrapped}, nil
+}
+
+// Encrypt encrypts plaintext under a new data key and returns an envelope
+// carrying both the wrapped data key and the ciphertext
+func (k *KMS) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	dk, err := k.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := dk.Encrypt(plaintext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+	return buildEnvelope(dk.Wrapped, payload), nil
+}
+
+// Decrypt opens an envelope produced by Encrypt
+func (k *KMS) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	wrapped, payload, err := parseEnvelope(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	dk, err := k.UnwrapDataKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return dk.Decrypt(payload, associatedData)
+}
+
+// Encrypt encrypts plaintext with the data key
+func (d *DataKey) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return d.primitive.Encrypt(plaintext, associatedData)
+}
+
+// Decrypt decrypts ciphertext with the data key
+func (d *DataKey) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return d.primitive.Decrypt(ciphertext, associatedData)
+}
+
+func buildEnvelope(wrapped, payload []byte) []byte {
+	out := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(wrapped)+len(payload))
+	out[0] = envelopeVersion
+	binary.BigEndian.PutUint32(out[1:envelopeHeaderSize], uint32(len(wrapped)))
+	out = append(out, wrapped...)
+	return append(out, payload...)
+}
+
+func parseEnvelope(ciphertext []byte) (wrapped, payload []byte, err error) {
+	if len(ciphertext) < envelopeHeaderSize || ciphertext[0] != envelopeVersion {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	n := binary.BigEndian.Uint32(ciphertext[1:envelopeHeaderSize])
+	if uint64(n) > uint64(len(ciphertext)-envelopeHeaderSize) {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	end := envelopeHeaderSize + int(n)
+	return ciphertext[envelopeHeaderSize:end], ciphertext[end:], nil
+}
@@ -0,0 +1,122 @@
+package security
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func newTestKMS(t *testing.T) *KMS {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "aead_keyset.bin")
+	if err := GenerateKeysetFile(path); err != nil {
+		t.Fatalf("generate keyset: %v", err)
+	}
+	k, err := NewKMS(path)
+	if err != nil {
+		t.Fatalf("new kms: %v", err)
+	}
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := newTestKMS(t)
+	plaintext, ad := []byte("ZAQ1@wsx"), []byte("db.password")
+
+	ct, err := k.Encrypt(plaintext, ad)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	pt, err := k.Decrypt(ct, ad)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if !bytes.Equal(pt, plaintext) {
+		t.Fatalf("got %q, want %q", pt, plaintext)
+	}
+	if _, err := k.Decrypt(ct, []byte("other")); err == nil {
+		t.Fatal("decrypt with wrong associated data succeeded")
+	}
+	if _, err := k.Decrypt(ct[:3], ad); err != ErrInvalidCiphertext {
+		t.Fatalf("got %v, want ErrInvalidCiphertext", err)
+	}
+}
+
+func TestWrapUnwrapDataKey(t *testing.T) {
+	k := newTestKMS(t)
+	dk, err := k.GenerateDataKey()
+	if err != nil {
+		t.Fatalf("generate data key: %v", err)
+	}
+	ct, err := dk.Encrypt([]byte("record"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	restored, err := k.UnwrapDataKey(dk.Wrapped)
+	if err != nil {
+		t.Fatalf("unwrap: %v", err)
+	}
+	pt, err := restored.Decrypt(ct, nil)
+	if err != nil || string(pt) != "record" {
+		t.Fatalf("decrypt with unwrapped key: %q, %v", pt, err)
+	}
+
+	if _, err := newTestKMS(t).UnwrapDataKey(dk.Wrapped); err == nil {
+		t.Fatal("unwrap with a different kek succeeded")
+	}
+}
+
+func TestRotateAndRewrap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aead_keyset.bin")
+	if err := GenerateKeysetFile(path); err != nil {
+		t.Fatalf("generate keyset: %v", err)
+	}
+	k, err := NewKMS(path)
+	if err != nil {
+		t.Fatalf("new kms: %v", err)
+	}
+	oldID := k.PrimaryKeyID()
+	ct, err := k.Encrypt([]byte("record"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	newID, err := AddKey(path)
+	if err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+	if err := PromoteKey(path, newID); err != nil {
+		t.Fatalf("promote key: %v", err)
+	}
+	if err := k.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if k.PrimaryKeyID() != newID {
+		t.Fatalf("primary %d, want %d", k.PrimaryKeyID(), newID)
+	}
+
+	rewrapped, changed, err := k.Rewrap(ct)
+	if err != nil || !changed {
+		t.Fatalf("rewrap: changed=%v err=%v", changed, err)
+	}
+	if id, _ := EnvelopeKeyID(rewrapped); id != newID {
+		t.Fatalf("rewrapped under %d, want %d", id, newID)
+	}
+	if _, changed, _ := k.Rewrap(rewrapped); changed {
+		t.Fatal("rewrap of current ciphertext changed it")
+	}
+
+	if err := DisableKey(path, oldID); err != nil {
+		t.Fatalf("disable key: %v", err)
+	}
+	if err := k.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, err := k.Decrypt(ct, nil); err == nil {
+		t.Fatal("decrypt with disabled key succeeded")
+	}
+	if pt, err := k.Decrypt(rewrapped, nil); err != nil || string(pt) != "record" {
+		t.Fatalf("decrypt rewrapped: %q, %v", pt, err)
+	}
+}
@@ -0,0 +1,54 @@
+package security
+
+import (
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/tink"
+)
+
+// Provider is the source of the key encryption key of a KMS, so the rest of
+// the application is agnostic of where the KEK lives
+type Provider interface {
+	// Name identifies the backend in logs
+	Name() string
+	// KEK returns the AEAD primitive of the key encryption key and the id of
+	// its primary version, 0 if versions are managed by the backend.
+	// It is called again on KMS.Reload.
+	KEK() (tink.AEAD, uint32, error)
+}
+
+// VersionedAEAD is implemented by KEKs whose versions are managed by the
+// backend, their KEK id is 0. KMS.Rewrap asks it whether a wrapped data key
+// still is encrypted by the current version.
+type VersionedAEAD interface {
+	tink.AEAD
+	// IsCurrentVersion tells if ciphertext was encrypted by the current KEK version
+	IsCurrentVersion(ciphertext []byte) (bool, error)
+}
+
+// FileProvider reads the KEK from a cleartext binary AEAD keyset on the file system
+type FileProvider struct {
+	path string
+}
+
+// NewFileProvider returns a Provider for the keyset at path
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+// Name implements Provider
+func (p *FileProvider) Name() string {
+	return "file:" + p.path
+}
+
+// KEK implements Provider
+func (p *FileProvider) KEK() (tink.AEAD, uint32, error) {
+	handle, err := ReadKeysetFile(p.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	kek, err := aead.New(handle)
+	if err != nil {
+		return nil, 0, err
+	}
+	return kek, handle.KeysetInfo().GetPrimaryKeyId(), nil
+}
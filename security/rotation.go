@@ -0,0 +1,187 @@
+package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/keyset"
+	tinkpb "github.com/google/tink/go/proto/tink_go_proto"
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+// A zero downtime KEK rotation is done in steps, reloading every running
+// process (KMS.Reload) after each step that changes the keyset file:
+//
+//  1. AddKey: the new version can decrypt everywhere but is not used yet
+//  2. PromoteKey: new data keys are wrapped with the new version
+//  3. KMS.Rewrap / database.ReencryptTable: existing data keys move to the new version
+//  4. DisableKey: the old version is no longer accepted
+
+const (
+	// tinkPrefixSize is the size of the key id prefix Tink puts on ciphertexts
+	tinkPrefixSize = 5
+	// tinkStartByte marks a ciphertext produced by a TINK output prefix key
+	tinkStartByte byte = 1
+)
+
+// KeyInfo describes a single version of a keyset
+type KeyInfo struct {
+	ID      uint32
+	Status  string
+	Primary bool
+}
+
+// ListKeys returns all key versions of the keyset at path
+func ListKeys(path string) ([]KeyInfo, error) {
+	handle, err := ReadKeysetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info := handle.KeysetInfo()
+	keys := make([]KeyInfo, 0, len(info.GetKeyInfo()))
+	for _, ki := range info.GetKeyInfo() {
+		keys = append(keys, KeyInfo{
+			ID:      ki.GetKeyId(),
+			Status:  ki.GetStatus().String(),
+			Primary: ki.GetKeyId() == info.GetPrimaryKeyId(),
+		})
+	}
+	return keys, nil
+}
+
+// AddKey adds a new enabled, non-primary AES256-GCM version to the keyset at path
+func AddKey(path string) (uint32, error) {
+	var keyID uint32
+	err := updateKeyset(path, func(m *keyset.Manager) (err error) {
+		keyID, err = m.Add(aead.AES256GCMKeyTemplate())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	auditLog().Info("kek key added", "path", path, "key_id", keyID)
+	return keyID, nil
+}
+
+// PromoteKey makes keyID the primary version of the keyset at path
+func PromoteKey(path string, keyID uint32) error {
+	if err := updateKeyset(path, func(m *keyset.Manager) error { return m.SetPrimary(keyID) }); err != nil {
+		return err
+	}
+	auditLog().Info("kek primary key changed", "path", path, "key_id", keyID)
+	return nil
+}
+
+// DisableKey disables keyID, ciphertexts wrapped by it can no longer be decrypted
+func DisableKey(path string, keyID uint32) error {
+	if err := updateKeyset(path, func(m *keyset.Manager) error { return m.Disable(keyID) }); err != nil {
+		return err
+	}
+	auditLog().Info("kek key disabled", "path", path, "key_id", keyID)
+	return nil
+}
+
+// EnableKey re-enables a previously disabled keyID
+func EnableKey(path string, keyID uint32) error {
+	if err := updateKeyset(path, func(m *keyset.Manager) error { return m.Enable(keyID) }); err != nil {
+		return err
+	}
+	auditLog().Info("kek key enabled", "path", path, "key_id", keyID)
+	return nil
+}
+
+// Rewrap re-encrypts the data key of an envelope under the primary KEK version.
+// The payload is left untouched. It reports false if the data key already
+// was wrapped by the primary version.
+func (k *KMS) Rewrap(ciphertext []byte) ([]byte, bool, error) {
+	wrapped, payload, err := parseEnvelope(ciphertext)
+	if err != nil {
+		return nil, false, err
+	}
+	if id, ok := WrappingKeyID(wrapped); ok && id == k.PrimaryKeyID() {
+		return ciphertext, false, nil
+	}
+	if current, err := k.isCurrentVersion(wrapped); err != nil {
+		return nil, false, err
+	} else if current {
+		return ciphertext, false, nil
+	}
+	handle, err := k.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, false, err
+	}
+	rewrapped, err := k.WrapKey(handle)
+	if err != nil {
+		return nil, false, err
+	}
+	return buildEnvelope(rewrapped, payload), true, nil
+}
+
+// isCurrentVersion asks a VersionedAEAD KEK if it wrapped the data key with its current version
+func (k *KMS) isCurrentVersion(wrapped []byte) (bool, error) {
+	versioned, ok := k.aead().(VersionedAEAD)
+	if !ok {
+		return false, nil
+	}
+	eks, err := keyset.NewBinaryReader(bytes.NewReader(wrapped)).ReadEncrypted()
+	if err != nil {
+		return false, fmt.Errorf("security: read wrapped data key: %w", err)
+	}
+	return versioned.IsCurrentVersion(eks.GetEncryptedKeyset())
+}
+
+// WrappingKeyID returns the id of the KEK version a wrapped data key was encrypted with
+func WrappingKeyID(wrapped []byte) (uint32, bool) {
+	eks, err := keyset.NewBinaryReader(bytes.NewReader(wrapped)).ReadEncrypted()
+	if err != nil {
+		return 0, false
+	}
+	ct := eks.GetEncryptedKeyset()
+	if len(ct) < tinkPrefixSize || ct[0] != tinkStartByte {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(ct[1:tinkPrefixSize]), true
+}
+
+// EnvelopeKeyID returns the id of the KEK version that wrapped the data key of an envelope
+func EnvelopeKeyID(ciphertext []byte) (uint32, bool) {
+	wrapped, _, err := parseEnvelope(ciphertext)
+	if err != nil {
+		return 0, false
+	}
+	return WrappingKeyID(wrapped)
+}
+
+// updateKeyset applies f to the keyset at path and atomically writes it back
+func updateKeyset(path string, f func(*keyset.Manager) error) error {
+	handle, err := ReadKeysetFile(path)
+	if err != nil {
+		return err
+	}
+	m := keyset.NewManagerFromHandle(handle)
+	if err := f(m); err != nil {
+		return fmt.Errorf("security: update keyset %s: %w", path, err)
+	}
+	if handle, err = m.Handle(); err != nil {
+		return err
+	}
+	if !hasPrimary(handle.KeysetInfo()) {
+		return fmt.Errorf("security: update keyset %s: primary key missing", path)
+	}
+	return WriteKeysetFile(handle, path)
+}
+
+func hasPrimary(info *tinkpb.KeysetInfo) bool {
+	for _, ki := range info.GetKeyInfo() {
+		if ki.GetKeyId() == info.GetPrimaryKeyId() && ki.GetStatus() == tinkpb.KeyStatusType_ENABLED {
+			return true
+		}
+	}
+	return false
+}
+
+func auditLog() logger.Logger {
+	return logger.WithName("kms-audit")
+}
@@ -0,0 +1,132 @@
+package security
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// EncryptedString is a string column encrypted at rest with the default KMS.
+// It is stored as the KMS envelope in a binary column. The envelope is not
+// bound to its row, copied to another row or column it still decrypts, use
+// the encrypted serializer of package database where that matters.
+type EncryptedString string
+
+// EncryptedJSON is a JSON document column encrypted at rest with the default
+// KMS, like EncryptedString its envelope is not bound to its row
+type EncryptedJSON json.RawMessage
+
+// Value implements driver.Valuer
+func (s EncryptedString) Value() (driver.Value, error) {
+	return encryptValue([]byte(s))
+}
+
+// Scan implements sql.Scanner
+func (s *EncryptedString) Scan(src interface{}) error {
+	pt, err := decryptValue(src)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(pt)
+	return nil
+}
+
+// GormDataType implements schema.GormDataTypeInterface
+func (EncryptedString) GormDataType() string {
+	return "bytes"
+}
+
+// BlindIndex computes the blind index of the plaintext with the default BlindIndexer
+func (s EncryptedString) BlindIndex() (BlindIndex, error) {
+	return NewBlindIndex(string(s))
+}
+
+// String returns the plaintext
+func (s EncryptedString) String() string {
+	return string(s)
+}
+
+// NewEncryptedJSON marshals v into an EncryptedJSON
+func NewEncryptedJSON(v interface{}) (EncryptedJSON, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptedJSON(b), nil
+}
+
+// Unmarshal decodes the plaintext document into v
+func (j EncryptedJSON) Unmarshal(v interface{}) error {
+	return json.Unmarshal(j, v)
+}
+
+// MarshalJSON returns the plaintext document
+func (j EncryptedJSON) MarshalJSON() ([]byte, error) {
+	if j == nil {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// UnmarshalJSON stores a copy of data
+func (j *EncryptedJSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[:0], data...)
+	return nil
+}
+
+// Value implements driver.Valuer
+func (j EncryptedJSON) Value() (driver.Value, error) {
+	if j == nil {
+		return nil, nil
+	}
+	if !json.Valid(j) {
+		return nil, fmt.Errorf("security: EncryptedJSON holds invalid json")
+	}
+	return encryptValue(j)
+}
+
+// Scan implements sql.Scanner
+func (j *EncryptedJSON) Scan(src interface{}) error {
+	if src == nil {
+		*j = nil
+		return nil
+	}
+	pt, err := decryptValue(src)
+	if err != nil {
+		return err
+	}
+	*j = EncryptedJSON(pt)
+	return nil
+}
+
+// GormDataType implements schema.GormDataTypeInterface
+func (EncryptedJSON) GormDataType() string {
+	return "bytes"
+}
+
+func encryptValue(plaintext []byte) (driver.Value, error) {
+	k := DefaultKMS()
+	if k == nil {
+		return nil, ErrNoKMS
+	}
+	return k.Encrypt(plaintext, nil)
+}
+
+func decryptValue(src interface{}) ([]byte, error) {
+	var ct []byte
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		ct = v
+	case string:
+		ct = []byte(v)
+	default:
+		return nil, fmt.Errorf("security: cannot scan %T into an encrypted column", src)
+	}
+	k := DefaultKMS()
+	if k == nil {
+		return nil, ErrNoKMS
+	}
+	return k.Decrypt(ct, nil)
+}
@@ -0,0 +1,86 @@
+package security
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedString(t *testing.T) {
+	SetDefaultKMS(newTestKMS(t))
+	defer SetDefaultKMS(nil)
+
+	v, err := EncryptedString("9876543210@upi").Value()
+	if err != nil {
+		t.Fatalf("value: %v", err)
+	}
+	if bytes.Contains(v.([]byte), []byte("9876543210")) {
+		t.Fatal("plaintext found in stored value")
+	}
+	var s EncryptedString
+	if err := s.Scan(v); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if s != "9876543210@upi" {
+		t.Fatalf("got %q", s)
+	}
+}
+
+func TestEncryptedJSON(t *testing.T) {
+	SetDefaultKMS(newTestKMS(t))
+	defer SetDefaultKMS(nil)
+
+	j, err := NewEncryptedJSON(map[string]string{"vpa": "9876543210@upi"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	v, err := j.Value()
+	if err != nil {
+		t.Fatalf("value: %v", err)
+	}
+	if bytes.Contains(v.([]byte), []byte("9876543210")) {
+		t.Fatal("plaintext found in stored value")
+	}
+	var got EncryptedJSON
+	if err := got.Scan(v); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	var m map[string]string
+	if err := got.Unmarshal(&m); err != nil || m["vpa"] != "9876543210@upi" {
+		t.Fatalf("got %v, %v", m, err)
+	}
+
+	// NULL
+	if v, err := EncryptedJSON(nil).Value(); v != nil || err != nil {
+		t.Fatalf("nil value: got %v, %v", v, err)
+	}
+	if err := got.Scan(nil); err != nil || got != nil {
+		t.Fatalf("scan nil: got %q, %v", got, err)
+	}
+	if _, err := EncryptedJSON("{").Value(); err == nil {
+		t.Fatal("stored invalid json")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prf_keyset.bin")
+	if err := GenerateBlindIndexKeysetFile(path); err != nil {
+		t.Fatalf("generate keyset: %v", err)
+	}
+	indexer, err := NewBlindIndexer(path)
+	if err != nil {
+		t.Fatalf("new indexer: %v", err)
+	}
+	SetDefaultBlindIndexer(indexer)
+	defer SetDefaultBlindIndexer(nil)
+
+	a, err := EncryptedString("9876543210").BlindIndex()
+	if err != nil {
+		t.Fatalf("blind index: %v", err)
+	}
+	b, _ := NewBlindIndex("9876543210")
+	c, _ := NewBlindIndex("9876543211")
+	if !bytes.Equal(a, b) || bytes.Equal(a, c) || len(a) != blindIndexSize {
+		t.Fatalf("unexpected blind indexes %x %x %x", a, b, c)
+	}
+}
@@ -0,0 +1,205 @@
+package security
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/tink/go/tink"
+)
+
+// VaultConfig configures the HashiCorp Vault transit backend
+type VaultConfig struct {
+	// Address of the vault server, e.g. https://vault:8200 (defaults to VAULT_ADDR)
+	Address string
+	// Token used to authenticate (defaults to VAULT_TOKEN)
+	Token string
+	// Namespace of the vault enterprise namespace, optional
+	Namespace string
+	// Mount path of the transit secrets engine (defaults to transit)
+	Mount string
+	// Key is the name of the transit key used as KEK
+	Key string
+	// Timeout of a single request (defaults to 10s)
+	Timeout time.Duration
+}
+
+// VaultProvider keeps the KEK inside a Vault transit secrets engine. Data keys
+// are wrapped and unwrapped by vault, the KEK never leaves it.
+type VaultProvider struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+// vaultAEAD implements tink.AEAD on top of the transit encrypt and decrypt endpoints
+type vaultAEAD struct {
+	p *VaultProvider
+
+	// Latest version of the transit key, read on first use
+	mu     sync.Mutex
+	latest int
+}
+
+type vaultResponse struct {
+	Data struct {
+		Ciphertext string `json:"ciphertext"`
+		Plaintext  string `json:"plaintext"`
+		// Of the keys endpoint, encrypt always uses the latest version
+		LatestVersion int `json:"latest_version"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// NewVaultProvider returns a Provider for the transit key described by cfg
+func NewVaultProvider(cfg VaultConfig) *VaultProvider {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "transit"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+	cfg.Mount = strings.Trim(cfg.Mount, "/")
+	return &VaultProvider{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Name implements Provider
+func (p *VaultProvider) Name() string {
+	return "vault:" + p.cfg.Mount + "/" + p.cfg.Key
+}
+
+// KEK implements Provider. The key versions are managed by vault, the
+// returned AEAD implements VersionedAEAD, which reads the latest version on
+// first use and again after KMS.Reload.
+func (p *VaultProvider) KEK() (tink.AEAD, uint32, error) {
+	if p.cfg.Address == "" || p.cfg.Key == "" {
+		return nil, 0, errors.New("security: vault address and key are required")
+	}
+	return &vaultAEAD{p: p}, 0, nil
+}
+
+// Encrypt implements tink.AEAD
+func (a *vaultAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}
+	if len(associatedData) > 0 {
+		req["associated_data"] = base64.StdEncoding.EncodeToString(associatedData)
+	}
+	resp, err := a.p.call(http.MethodPost, "encrypt", req)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// Decrypt implements tink.AEAD
+func (a *vaultAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	req := map[string]string{"ciphertext": string(ciphertext)}
+	if len(associatedData) > 0 {
+		req["associated_data"] = base64.StdEncoding.EncodeToString(associatedData)
+	}
+	resp, err := a.p.call(http.MethodPost, "decrypt", req)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// IsCurrentVersion implements VersionedAEAD, comparing the vault:vN: prefix
+// of ciphertext with the latest version of the transit key
+func (a *vaultAEAD) IsCurrentVersion(ciphertext []byte) (bool, error) {
+	version, ok := vaultVersion(string(ciphertext))
+	if !ok {
+		return false, nil
+	}
+	latest, err := a.latestVersion()
+	if err != nil {
+		return false, err
+	}
+	return version == latest, nil
+}
+
+func (a *vaultAEAD) latestVersion() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.latest > 0 {
+		return a.latest, nil
+	}
+	resp, err := a.p.call(http.MethodGet, "keys", nil)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Data.LatestVersion <= 0 {
+		return 0, fmt.Errorf("security: vault key %s has no latest version", a.p.cfg.Key)
+	}
+	a.latest = resp.Data.LatestVersion
+	return a.latest, nil
+}
+
+// vaultVersion parses the version of a ciphertext like vault:v3:...
+func vaultVersion(ciphertext string) (int, bool) {
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return 0, false
+	}
+	version, err := strconv.Atoi(parts[1][1:])
+	return version, err == nil
+}
+
+func (p *VaultProvider) call(method, op string, body map[string]string) (*vaultResponse, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/%s/%s", p.cfg.Address, p.cfg.Mount, op, url.PathEscape(p.cfg.Key))
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Vault-Token", p.cfg.Token)
+	if p.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("security: vault %s: %w", op, err)
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("security: vault %s: %w", op, err)
+	}
+	resp := &vaultResponse{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, resp); err != nil {
+			return nil, fmt.Errorf("security: vault %s: status %d: %w", op, res.StatusCode, err)
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("security: vault %s: status %d: %s", op, res.StatusCode, strings.Join(resp.Errors, "; "))
+	}
+	return resp, nil
+}
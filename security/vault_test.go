@@ -0,0 +1,108 @@
+package security
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/keyset"
+)
+
+// newTransitStandIn serves the encrypt, decrypt and keys endpoints of a vault
+// transit key, encrypt uses the version *latest points to
+func newTransitStandIn(t *testing.T, token, key string, latest *int) *httptest.Server {
+	t.Helper()
+	handle, err := keyset.NewHandle(aead.AES256GCMKeyTemplate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transit, err := aead.New(handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		data := map[string]interface{}{}
+		switch r.URL.Path {
+		case "/v1/transit/keys/" + key:
+			data["latest_version"] = *latest
+		case "/v1/transit/encrypt/" + key:
+			pt, _ := base64.StdEncoding.DecodeString(req["plaintext"])
+			ct, _ := transit.Encrypt(pt, nil)
+			data["ciphertext"] = fmt.Sprintf("vault:v%d:%s", *latest, base64.StdEncoding.EncodeToString(ct))
+		case "/v1/transit/decrypt/" + key:
+			parts := strings.SplitN(req["ciphertext"], ":", 3)
+			ct, _ := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+			pt, err := transit.Decrypt(ct, nil)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":["cipher: message authentication failed"]}`))
+				return
+			}
+			data["plaintext"] = base64.StdEncoding.EncodeToString(pt)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+}
+
+func TestVaultProvider(t *testing.T) {
+	latest := 1
+	srv := newTransitStandIn(t, "s.test", "rpc-bp", &latest)
+	defer srv.Close()
+
+	k, err := NewKMSWithProvider(NewVaultProvider(VaultConfig{Address: srv.URL, Token: "s.test", Key: "rpc-bp"}))
+	if err != nil {
+		t.Fatalf("new kms: %v", err)
+	}
+	ct, err := k.Encrypt([]byte("record"), []byte("ad"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	pt, err := k.Decrypt(ct, []byte("ad"))
+	if err != nil || string(pt) != "record" {
+		t.Fatalf("decrypt: %q, %v", pt, err)
+	}
+	if _, changed, err := k.Rewrap(ct); err != nil || changed {
+		t.Fatalf("rewrap of current version: changed=%v err=%v", changed, err)
+	}
+
+	// Rotated in vault, picked up on reload
+	latest = 2
+	if err := k.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	rewrapped, changed, err := k.Rewrap(ct)
+	if err != nil || !changed {
+		t.Fatalf("rewrap after rotation: changed=%v err=%v", changed, err)
+	}
+	if !bytes.Contains(rewrapped, []byte("vault:v2:")) {
+		t.Fatal("data key not wrapped by vault:v2")
+	}
+	if _, changed, err := k.Rewrap(rewrapped); err != nil || changed {
+		t.Fatalf("second rewrap: changed=%v err=%v", changed, err)
+	}
+	if pt, err := k.Decrypt(rewrapped, []byte("ad")); err != nil || string(pt) != "record" {
+		t.Fatalf("decrypt rewrapped: %q, %v", pt, err)
+	}
+
+	denied, _ := NewKMSWithProvider(NewVaultProvider(VaultConfig{Address: srv.URL, Token: "wrong", Key: "rpc-bp"}))
+	if _, err := denied.Decrypt(ct, []byte("ad")); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("got %v, want permission denied", err)
+	}
+}
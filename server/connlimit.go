@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/metrics"
+)
+
+// Reasons of rejected connections, the reason label of the metric
+const (
+	rejectMaxConnections      = "max_connections"
+	rejectMaxConnectionsPerIP = "max_connections_per_ip"
+)
+
+// Rejections are logged at most once per interval, with the number left out
+const rejectLogInterval = time.Second
+
+var errConnRejected = errors.New("connection rejected: too many connections from the client")
+
+// connLimits caps the connections ServeFromListener and ServeContext accept
+type connLimits struct {
+	// Server name, the label of the metrics
+	name string
+	// Open connections of all clients, 0 is unlimited
+	maxConns int
+	// Open connections of each client IP, 0 is unlimited
+	maxPerIP int
+}
+
+// wrap returns lis limited to the connections, lis itself without limits
+func (c connLimits) wrap(lis net.Listener, log logger.Logger) net.Listener {
+	if c.maxConns <= 0 && c.maxPerIP <= 0 {
+		return lis
+	}
+	return &limitListener{Listener: lis, limits: c, log: log, perIP: map[string]int{}}
+}
+
+// limitListener closes connections over the limits right after accepting them
+type limitListener struct {
+	net.Listener
+	limits connLimits
+	log    logger.Logger
+
+	mu         sync.Mutex
+	conns      int
+	perIP      map[string]int
+	lastLog    time.Time
+	suppressed int
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if !l.acquire() {
+			conn.Close()
+			l.reject(conn, rejectMaxConnections)
+			continue
+		}
+		lc := &limitConn{Conn: conn, l: l}
+		if l.limits.maxPerIP > 0 {
+			// The client of a PROXY protocol connection is known once the
+			// header was read, which must not block Accept
+			if _, ok := conn.(*proxyConn); ok {
+				lc.lazy = true
+			} else if !lc.admit() {
+				continue
+			}
+		}
+		return lc, nil
+	}
+}
+
+// acquire takes a slot of the global limit
+func (l *limitListener) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.maxConns > 0 && l.conns >= l.limits.maxConns {
+		return false
+	}
+	l.conns++
+	metrics.ConnOpened(l.limits.name)
+	return true
+}
+
+// acquireIP takes a slot of the cap of ip
+func (l *limitListener) acquireIP(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP[ip] >= l.limits.maxPerIP {
+		return false
+	}
+	l.perIP[ip]++
+	return true
+}
+
+// release frees the slots of a closed connection, ip is empty if it was not capped
+func (l *limitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns--
+	if ip != "" {
+		if l.perIP[ip]--; l.perIP[ip] <= 0 {
+			delete(l.perIP, ip)
+		}
+	}
+	metrics.ConnClosed(l.limits.name)
+}
+
+// reject counts and logs a rejected connection
+func (l *limitListener) reject(conn net.Conn, reason string) {
+	metrics.ConnRejected(l.limits.name, reason)
+	l.mu.Lock()
+	now := time.Now()
+	if now.Sub(l.lastLog) < rejectLogInterval {
+		l.suppressed++
+		l.mu.Unlock()
+		return
+	}
+	suppressed := l.suppressed
+	l.lastLog, l.suppressed = now, 0
+	l.mu.Unlock()
+
+	// The address of the connection itself, RemoteAddr of a PROXY protocol connection may block
+	raddr := conn.RemoteAddr
+	if pc, ok := conn.(*proxyConn); ok && reason == rejectMaxConnections {
+		raddr = pc.Conn.RemoteAddr
+	}
+	l.log.Warn("connection rejected", "reason", reason, "raddr", raddr().String(), "max_connections", l.limits.maxConns, "max_connections_per_ip", l.limits.maxPerIP, "suppressed", suppressed)
+}
+
+// limitConn releases its slots when closed
+type limitConn struct {
+	net.Conn
+	l *limitListener
+	// Client IP counted against the per-IP cap
+	ip string
+	// The per-IP cap is checked on the first Read
+	lazy     bool
+	check    sync.Once
+	rejected bool
+	close    sync.Once
+}
+
+// admit checks the per-IP cap, the connection is closed if it is exceeded.
+// Connections without IP, e.g. unix sockets, are not capped.
+func (c *limitConn) admit() bool {
+	tcp, ok := c.Conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	ip := tcp.IP.String()
+	if !c.l.acquireIP(ip) {
+		c.Conn.Close()
+		c.close.Do(func() { c.l.release("") })
+		c.l.reject(c.Conn, rejectMaxConnectionsPerIP)
+		return false
+	}
+	c.ip = ip
+	return true
+}
+
+func (c *limitConn) Read(b []byte) (int, error) {
+	if c.lazy {
+		c.check.Do(func() { c.rejected = !c.admit() })
+		if c.rejected {
+			return 0, errConnRejected
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *limitConn) Close() error {
+	if c.lazy {
+		// Waits for a running check, a connection closed before its first Read is not checked anymore
+		c.check.Do(func() { c.rejected = true })
+	}
+	err := c.Conn.Close()
+	c.close.Do(func() { c.l.release(c.ip) })
+	return err
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/realip"
+)
+
+// serveLimited accepts on lis limited by limits, writing "ok" to every
+// connection admitted and keeping it open until the client closes it
+func serveLimited(lis net.Listener, limits connLimits) {
+	lis = limits.wrap(lis, logger.WithName("test"))
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// Reading first checks the per-IP cap of PROXY protocol connections
+				b := make([]byte, 1)
+				if _, err := conn.Read(b); err != nil {
+					conn.Close()
+					return
+				}
+				conn.Write([]byte("ok"))
+				// Like a server, close once the client did
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+}
+
+// admitted tells if the connection got "ok" or was closed
+func admitted(t *testing.T, addr, header string) (net.Conn, bool) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte(header + "x"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	b := make([]byte, 2)
+	_, err = io.ReadFull(conn, b)
+	return conn, err == nil && string(b) == "ok"
+}
+
+func TestLimitListener(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limits connLimits
+	}{
+		{"max connections", connLimits{name: "test", maxConns: 2}},
+		{"max connections per ip", connLimits{name: "test", maxPerIP: 2}},
+	} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		serveLimited(lis, tc.limits)
+		addr := lis.Addr().String()
+
+		first, ok1 := admitted(t, addr, "")
+		second, ok2 := admitted(t, addr, "")
+		third, ok3 := admitted(t, addr, "")
+		if !ok1 || !ok2 || ok3 {
+			t.Fatalf("%s: admitted %v, %v, %v", tc.name, ok1, ok2, ok3)
+		}
+		third.Close()
+
+		// A closed connection frees its slot
+		first.Close()
+		time.Sleep(50 * time.Millisecond)
+		again, ok := admitted(t, addr, "")
+		if !ok {
+			t.Fatalf("%s: slot not freed", tc.name)
+		}
+		again.Close()
+		second.Close()
+		lis.Close()
+	}
+}
+
+func TestLimitListenerProxyProtocol(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	trusted, _ := realip.ParseCIDRs("127.0.0.1")
+	serveLimited(NewProxyProtocolListener(lis, trusted), connLimits{name: "test", maxPerIP: 1})
+	addr := lis.Addr().String()
+
+	// The cap applies to the clients behind the proxy, not the proxy
+	a, okA := admitted(t, addr, "PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\n")
+	b, okB := admitted(t, addr, "PROXY TCP4 203.0.113.8 10.0.0.1 56325 443\r\n")
+	c, okC := admitted(t, addr, "PROXY TCP4 203.0.113.7 10.0.0.1 56326 443\r\n")
+	defer a.Close()
+	defer b.Close()
+	defer c.Close()
+	if !okA || !okB || okC {
+		t.Fatalf("admitted %v, %v, %v", okA, okB, okC)
+	}
+}
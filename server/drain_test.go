@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	api "github.com/karthikraman22/rpc-bp/health"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDrainDuringPreStopDelay(t *testing.T) {
+	const preStopDelay = 500 * time.Millisecond
+	api.SetReady(true)
+	t.Cleanup(func() { api.SetReady(true) })
+
+	grpcSrv := NewGrpcServerWithOptions("drain-test-grpc", WithPreStopDelay(preStopDelay))
+	restSrv := NewRestServerWithOptions("drain-test-rest", WithProfile("release"), WithPreStopDelay(preStopDelay))
+	restSrv.RegisterService(func(r *gin.Engine) { r.GET("/ready", api.ReadinessProbe()) })
+
+	grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 2)
+	go func() { stopped <- grpcSrv.ServeContext(ctx, grpcLis) }()
+	go func() { stopped <- restSrv.ServeContext(ctx, restLis) }()
+
+	conn, err := grpc.Dial(grpcLis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	health := healthpb.NewHealthClient(conn)
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("health check: %v", err)
+		}
+		return resp.Status
+	}
+	readiness := func() int {
+		res, err := http.Get("http://" + restLis.Addr().String() + "/ready")
+		if err != nil {
+			t.Fatalf("readiness: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if s, code := check(), readiness(); s != healthpb.HealthCheckResponse_SERVING || code != http.StatusOK {
+		t.Fatalf("before shutdown: got %s, %d", s, code)
+	}
+
+	start := time.Now()
+	cancel()
+	// Both servers still answer during the pre-stop delay, reporting not ready
+	deadline := start.Add(preStopDelay / 2)
+	for check() != healthpb.HealthCheckResponse_NOT_SERVING {
+		if time.Now().After(deadline) {
+			t.Fatal("health not NOT_SERVING during the pre-stop delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := readiness(); code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness during the pre-stop delay: got %d", code)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-stopped; err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < preStopDelay {
+		t.Fatalf("stopped after %s, before the pre-stop delay", elapsed)
+	}
+}
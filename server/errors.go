@@ -0,0 +1,10 @@
+package server
+
+import "errors"
+
+var (
+	// ErrUnexpectedStop is returned when a server stopped serving without a planned shutdown, e.g. its listener failed
+	ErrUnexpectedStop = errors.New("server stopped unexpectedly")
+	// ErrShutdownTimeout is returned when in-flight requests did not finish within the shutdown timeout
+	ErrShutdownTimeout = errors.New("graceful shutdown timed out")
+)
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/karthikraman22/rpc-bp/logger"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// GatewayRegistrar registers the REST handlers of a gRPC service, it matches
+// the Register<Service>Handler functions generated by protoc-gen-grpc-gateway
+type GatewayRegistrar func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+type ginContextKey struct{}
+
+// DialGateway connects the gateway to the gRPC server at target. The
+// connection propagates the trace of the REST request to the gRPC server.
+func DialGateway(ctx context.Context, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	}, opts...)
+	return grpc.DialContext(ctx, target, opts...)
+}
+
+// RegisterGateway mounts the grpc-gateway handlers of registrars into the gin
+// router, calling the gRPC services over conn. Requests below pathPrefix are
+// routed to the gateway, an empty pathPrefix routes all requests not matching
+// a gin route. The correlation id and the original request line are forwarded
+// as metadata, so both transports log the same request.
+func (s *RestServer) RegisterGateway(ctx context.Context, pathPrefix string, conn *grpc.ClientConn, registrars ...GatewayRegistrar) error {
+	gw := runtime.NewServeMux(
+		runtime.WithMetadata(gatewayMetadata),
+		runtime.WithIncomingHeaderMatcher(gatewayIncomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(gatewayOutgoingHeaderMatcher),
+		runtime.WithErrorHandler(gatewayErrorHandler),
+	)
+	for _, register := range registrars {
+		if err := register(ctx, gw, conn); err != nil {
+			return err
+		}
+	}
+
+	handler := func(c *gin.Context) {
+		gw.ServeHTTP(c.Writer, c.Request.WithContext(context.WithValue(c.Request.Context(), ginContextKey{}, c)))
+	}
+	if pathPrefix == "" {
+		s.router.NoRoute(handler)
+	} else {
+		s.router.Any(pathPrefix+"/*path", handler)
+	}
+	return nil
+}
+
+// gatewayMetadata forwards the correlation id and the request line read by getGwInfo of the logging interceptor
+func gatewayMetadata(ctx context.Context, req *http.Request) metadata.MD {
+	md := metadata.Pairs(
+		"x-forwarded-method", req.Method,
+		"x-forwarded-path", req.URL.Path,
+		"x-forwarded-scheme", scheme(req),
+		"x-forwarded-user-agent", req.UserAgent(),
+		"x-forwarded-remote-addr", req.RemoteAddr,
+	)
+	if id := logger.CorrelationID(ctx); id != "" {
+		md.Set(logger.CORRELATION_ID.String(), id)
+	}
+	// Without OpenTelemetry spans the client interceptor propagates nothing, keep the trace of the logs
+	if tc, ok := logger.TraceContextFromContext(ctx); ok && !trace.SpanContextFromContext(ctx).IsValid() {
+		md.Set(logger.TraceparentHeader, tc.Traceparent())
+		if tc.State != "" {
+			md.Set(logger.TracestateHeader, tc.State)
+		}
+	}
+	return md
+}
+
+// gatewayIncomingHeaderMatcher drops Grpc-Metadata-X-Forwarded-* headers of
+// the client, they would come before the metadata set by gatewayMetadata and
+// forge the client address or request line
+func gatewayIncomingHeaderMatcher(key string) (string, bool) {
+	if strings.HasPrefix(textproto.CanonicalMIMEHeaderKey(key), runtime.MetadataHeaderPrefix+"X-Forwarded-") {
+		return "", false
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// gatewayOutgoingHeaderMatcher drops the correlation id echoed by the gRPC server, gin already set it
+func gatewayOutgoingHeaderMatcher(key string) (string, bool) {
+	if key == logger.CORRELATION_ID.String() {
+		return "", false
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// gatewayErrorHandler writes the status like runtime.DefaultHTTPErrorHandler and records it for the gin logging handler
+func gatewayErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if c, ok := r.Context().Value(ginContextKey{}).(*gin.Context); ok {
+		_ = c.Error(err)
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
+
+// AbortWithStatus ends a gin request with err converted to a gRPC status, the
+// HTTP code and JSON body are the same as for errors returned via the gateway
+func AbortWithStatus(c *gin.Context, err error) {
+	st := status.Convert(err)
+	body, merr := protojson.Marshal(st.Proto())
+	if merr != nil {
+		body = []byte(`{"code": 13, "message": "failed to marshal error message"}`)
+	}
+	_ = c.Error(err)
+	c.Data(runtime.HTTPStatusFromCode(st.Code()), "application/json", body)
+	c.Abort()
+}
+
+func scheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/karthikraman22/rpc-bp/realip"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// registerHealthGateway maps GET /v1/health to Health.Check like a handler
+// generated by protoc-gen-grpc-gateway
+func registerHealthGateway(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+	client := healthpb.NewHealthClient(conn)
+	return mux.HandlePath(http.MethodGet, "/v1/health", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/grpc.health.v1.Health/Check", runtime.WithHTTPPathPattern("/v1/health"))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		var md runtime.ServerMetadata
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: r.URL.Query().Get("service")}, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, resp)
+	})
+}
+
+// gatewayCall is what the gRPC server saw of a call forwarded by the gateway
+type gatewayCall struct {
+	md     metadata.MD
+	client realip.Client
+}
+
+// startGateway serves a gRPC server in-process and a RestServer forwarding
+// /v1 to it on a TCP listener. It returns the REST base url and the calls
+// the gRPC server received.
+func startGateway(t *testing.T, restOpts ...Option) (string, *RestServer, func() []gatewayCall) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var mu sync.Mutex
+	var calls []gatewayCall
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		client, _ := realip.FromContext(ctx)
+		mu.Lock()
+		calls = append(calls, gatewayCall{md, client})
+		mu.Unlock()
+		return handler(ctx, req)
+	}
+	grpcLis := NewInProcessListener()
+	go NewGrpcServerWithOptions("test-grpc", WithUnaryInterceptors(record)).ServeContext(ctx, grpcLis)
+
+	conn, err := DialGateway(ctx, "inprocess", grpcLis.DialOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	rest := NewRestServerWithOptions("test-rest", append([]Option{WithProfile("release")}, restOpts...)...)
+	if err := rest.RegisterGateway(ctx, "/v1", conn, registerHealthGateway); err != nil {
+		t.Fatal(err)
+	}
+	restLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go rest.ServeContext(ctx, restLis)
+
+	return "http://" + restLis.Addr().String(), rest, func() []gatewayCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]gatewayCall{}, calls...)
+	}
+}
+
+func TestGatewayForgedRemoteAddr(t *testing.T) {
+	url, _, calls := startGateway(t)
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/v1/health", nil)
+	req.Header.Set("Grpc-Metadata-X-Forwarded-Remote-Addr", "203.0.113.7:4711")
+	req.Header.Set("Grpc-Metadata-X-Forwarded-Path", "/forged")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", res.StatusCode)
+	}
+
+	got := calls()
+	if len(got) != 1 {
+		t.Fatalf("got %d calls", len(got))
+	}
+	if ip := got[0].client.IP.String(); ip != "127.0.0.1" {
+		t.Fatalf("resolved client %s, the forged address", ip)
+	}
+	if v := got[0].md.Get("x-forwarded-remote-addr"); len(v) != 1 {
+		t.Fatalf("got x-forwarded-remote-addr %v", v)
+	}
+	if v := got[0].md.Get("x-forwarded-path"); len(v) != 1 || v[0] != "/v1/health" {
+		t.Fatalf("got x-forwarded-path %v", v)
+	}
+}
+
+func TestGatewayForwardsRequest(t *testing.T) {
+	url, _, calls := startGateway(t)
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/v1/health", nil)
+	req.Header.Set("X-Correlation-Id", "gw-1")
+	req.Header.Set("User-Agent", "gateway-test")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", res.StatusCode)
+	}
+	// Echoed by gin only, the one of the gRPC server is dropped
+	if v := res.Header.Values("X-Correlation-Id"); len(v) != 1 || v[0] != "gw-1" {
+		t.Fatalf("got correlation id %v", v)
+	}
+
+	got := calls()
+	if len(got) != 1 {
+		t.Fatalf("got %d calls", len(got))
+	}
+	for k, want := range map[string]string{
+		"x-correlation-id":       "gw-1",
+		"x-forwarded-method":     http.MethodGet,
+		"x-forwarded-path":       "/v1/health",
+		"x-forwarded-scheme":     "http",
+		"x-forwarded-user-agent": "gateway-test",
+	} {
+		if v := got[0].md.Get(k); len(v) != 1 || v[0] != want {
+			t.Fatalf("%s: got %v, want %s", k, v, want)
+		}
+	}
+}
+
+func TestGatewayErrorStatus(t *testing.T) {
+	url, rest, _ := startGateway(t)
+	rest.RegisterService(func(r *gin.Engine) {
+		r.GET("/abort", func(c *gin.Context) { AbortWithStatus(c, status.Error(codes.NotFound, "unknown service")) })
+	})
+
+	// The gateway and AbortWithStatus answer a gRPC status the same way
+	for _, path := range []string{"/v1/health?service=unknown", "/abort"} {
+		res, err := http.Get(url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusNotFound || res.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("%s: got status %d, content type %s", path, res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		var st struct {
+			Code    codes.Code `json:"code"`
+			Message string     `json:"message"`
+		}
+		if err := json.Unmarshal(body, &st); err != nil {
+			t.Fatalf("%s: body %s: %v", path, body, err)
+		}
+		if st.Code != codes.NotFound || st.Message != "unknown service" {
+			t.Fatalf("%s: got %s", path, body)
+		}
+	}
+}
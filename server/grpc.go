@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -8,15 +9,22 @@ import (
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/karthikraman22/rpc-bp/config"
+	api "github.com/karthikraman22/rpc-bp/health"
 	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/metrics"
+	"github.com/karthikraman22/rpc-bp/realip"
 	"github.com/karthikraman22/rpc-bp/util"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
-	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
+// Time granted to in-flight requests once a graceful shutdown started
+const defaultShutdownTimeout = 30 * time.Second
+
 // Server is the implementation of an API Server
 type Server struct {
 	// gRPC-server exposing both the API and health
@@ -25,6 +33,16 @@ type Server struct {
 	log logger.Logger
 	//
 	shutdown *util.ShutdownWaitGroup
+	// Reports NOT_SERVING once the server drains
+	health *health.Server
+	// Time granted to in-flight RPCs once a graceful shutdown started
+	shutdownTimeout time.Duration
+	// How Serve and Run listen on their address
+	listen listenConfig
+	// Connections ServeFromListener and ServeContext accept
+	limits connLimits
+	// Time the server keeps serving after reporting NOT_SERVING
+	preStopDelay time.Duration
 }
 
 // NewServer returns a new configured instance of Server
@@ -34,11 +52,38 @@ func NewGrpcServer(name string, keepAlive bool) *Server {
 
 // NewServerWithOpts returns a new configured instance of Server with additional interceptros specified
 func NewServerWithOpts(name string, keepAlive bool, unaryServerInterceptors []grpc.UnaryServerInterceptor, streamServerInterceptors []grpc.StreamServerInterceptor) *Server {
+	opts := []Option{WithUnaryInterceptors(unaryServerInterceptors...), WithStreamInterceptors(streamServerInterceptors...)}
+	if keepAlive {
+		opts = append(opts, WithKeepalive(defaultKeepalive))
+	}
+	return NewGrpcServerWithOptions(name, opts...)
+}
+
+// NewGrpcServerFromConfig returns a Server configured by the `server.grpc`
+// section of cfg, opts take precedence over the config
+func NewGrpcServerFromConfig(name string, cfg *config.Config, opts ...Option) *Server {
+	return NewGrpcServerWithOptions(name, append(GrpcOptionsFromConfig(cfg), opts...)...)
+}
+
+// NewGrpcServerWithOptions returns a new configured instance of Server
+func NewGrpcServerWithOptions(name string, opts ...Option) *Server {
+	o := newOptions(opts)
 	s := &Server{
-		log:      logger.WithName(name),
-		shutdown: util.NewShutdownWaitGroup(),
+		log:             logger.WithName(name),
+		shutdown:        o.shutdown,
+		health:          health.NewServer(),
+		shutdownTimeout: o.shutdownTimeout,
+		preStopDelay:    o.preStopDelay,
+		listen:          o.listenConfig(),
+		limits:          o.connLimits(name),
 	}
 
+	// Tracing and metrics wrap all other interceptors, so their work is part of the span and latency.
+	// The client is resolved before the interceptors given, e.g. for rate limiting.
+	resolver := realip.NewResolver(o.trustedProxies...)
+	unaryServerInterceptors := append([]grpc.UnaryServerInterceptor{otelgrpc.UnaryServerInterceptor(), metrics.UnaryServerInterceptor(), realip.UnaryServerInterceptor(resolver)}, o.unaryInterceptors...)
+	streamServerInterceptors := append([]grpc.StreamServerInterceptor{otelgrpc.StreamServerInterceptor(), metrics.StreamServerInterceptor(), realip.StreamServerInterceptor(resolver)}, o.streamInterceptors...)
+
 	// Add default interceptors
 	unaryServerInterceptors = append(unaryServerInterceptors,
 		grpc_ctxtags.UnaryServerInterceptor(),
@@ -49,6 +94,8 @@ func NewServerWithOpts(name string, keepAlive bool, unaryServerInterceptors []gr
 		//grpc_validator_wrapper.UnaryServerInterceptor(), // add message validator wrapper
 	)
 	streamServerInterceptors = append(streamServerInterceptors,
+		grpc_ctxtags.StreamServerInterceptor(),
+		logger.StreamServerInterceptor(s.log),
 		grpc_recovery.StreamServerInterceptor(), // add recovery from panics
 		// own wrapper is used to unpack nested messages
 		//grpc_validator.StreamServerInterceptor(), // add message validator
@@ -56,20 +103,32 @@ func NewServerWithOpts(name string, keepAlive bool, unaryServerInterceptors []gr
 	)
 
 	// Configure gRPC server
-	opts := []grpc.ServerOption{
+	serverOpts := []grpc.ServerOption{
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamServerInterceptors...)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryServerInterceptors...)),
 	}
-	if keepAlive {
-		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
-			MaxConnectionIdle: 5 * time.Minute,
-			Time:              2 * time.Second,
-		}))
+	if o.keepalive != nil {
+		serverOpts = append(serverOpts, grpc.KeepaliveParams(*o.keepalive))
+	}
+	if o.enforcement != nil {
+		serverOpts = append(serverOpts, grpc.KeepaliveEnforcementPolicy(*o.enforcement))
 	}
-	s.grpc = grpc.NewServer(opts...)
+	if o.maxRecvMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(o.maxRecvMsgSize))
+	}
+	if o.maxSendMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxSendMsgSize(o.maxSendMsgSize))
+	}
+	if o.maxConcurrentStreams > 0 {
+		serverOpts = append(serverOpts, grpc.MaxConcurrentStreams(o.maxConcurrentStreams))
+	}
+	if o.connectionTimeout > 0 {
+		serverOpts = append(serverOpts, grpc.ConnectionTimeout(o.connectionTimeout))
+	}
+	s.grpc = grpc.NewServer(append(serverOpts, o.serverOptions...)...)
 
 	// Add grpc health check service
-	healthpb.RegisterHealthServer(s.grpc, health.NewServer())
+	healthpb.RegisterHealthServer(s.grpc, s.health)
 
 	// Enable reflection API
 	reflection.Register(s.grpc)
@@ -85,7 +144,7 @@ func (s *Server) RegisterService(f func(grpc.ServiceRegistrar)) {
 // Serve starts the api listeners of the Server
 func (s *Server) Serve(apiAddr string) error {
 	// Setup grpc listener
-	apiLis, err := net.Listen("tcp", apiAddr)
+	apiLis, err := s.listen.listen(apiAddr, s.log)
 	if err != nil {
 		return err
 	}
@@ -95,30 +154,115 @@ func (s *Server) Serve(apiAddr string) error {
 
 // ServeFromListener starts the api listeners of the Server
 func (s *Server) ServeFromListener(apiLis net.Listener) error {
+	apiLis = s.limits.wrap(apiLis, s.log)
 	shutdown := s.shutdown
 
 	// Start routine waiting for signals
+	stopErr := make(chan error, 1)
 	shutdown.RegisterSignalHandler(func() {
 		//  gRPC server
-		s.log.Info("grpc server stopping gracefully")
-		s.grpc.GracefulStop()
+		s.drain()
+		stopErr <- s.gracefulStop(s.shutdownTimeout)
 	})
 
 	s.log.Info("starting to serve grpc", "addr", apiLis.Addr())
+	// READY=1 once per process, with several servers app.App sends it once all started
+	defer util.SdServing(s.log)()
 	err := s.grpc.Serve(apiLis)
 	s.log.Info("grpc server stopped")
 
 	// Check if we are expecting shutdown
 	if !shutdown.IsExpected() {
-		panic(fmt.Sprintf("shutdown unexpected, grpc serve returned: %v", err))
+		return fmt.Errorf("%w: grpc serve returned: %v", ErrUnexpectedStop, err)
 	}
 	// Wait for both shutdown signals and close the channel
-	if ok := shutdown.WaitOrTimeout(30 * time.Second); !ok {
-		panic("shutting down gracefully exceeded 30 seconds")
+	timeout := s.preStopDelay + s.shutdownTimeout + shutdown.ShutdownHooks.Timeout()
+	if ok := shutdown.WaitOrTimeout(timeout); !ok {
+		return fmt.Errorf("%w: exceeded %s", ErrShutdownTimeout, timeout)
+	}
+	select {
+	case err := <-stopErr:
+		return err
+	default:
 	}
 	return err // Return the error, if grpc stopped gracefully there is no error
 }
 
+// Run serves on apiAddr until ctx is cancelled, then stops gracefully. Unlike
+// Serve it leaves signal handling to the caller, e.g. app.App.
+func (s *Server) Run(ctx context.Context, apiAddr string) error {
+	apiLis, err := s.listen.listen(apiAddr, s.log)
+	if err != nil {
+		return err
+	}
+	defer apiLis.Close()
+	return s.ServeContext(ctx, apiLis)
+}
+
+// ServeContext serves on apiLis until ctx is cancelled, then stops gracefully.
+// It returns an error if serving stopped without ctx being cancelled. Once
+// serving it calls util.Ready(ctx), app.App reports the process ready to
+// systemd when all its servers did.
+func (s *Server) ServeContext(ctx context.Context, apiLis net.Listener) error {
+	apiLis = s.limits.wrap(apiLis, s.log)
+	served := make(chan error, 1)
+	s.log.Info("starting to serve grpc", "addr", apiLis.Addr())
+	// apiLis is bound, app.App waits for this before reporting ready
+	util.Ready(ctx)
+	go func() {
+		served <- s.grpc.Serve(apiLis)
+	}()
+
+	select {
+	case err := <-served:
+		s.log.Info("grpc server stopped")
+		return fmt.Errorf("%w: grpc serve returned: %v", ErrUnexpectedStop, err)
+	case <-ctx.Done():
+	}
+
+	s.drain()
+	if err := s.gracefulStop(s.shutdownTimeout); err != nil {
+		return err
+	}
+	return <-served
+}
+
+// drain reports NOT_SERVING on the health service and the readiness probe,
+// then keeps serving for the pre-stop delay so clients move away
+func (s *Server) drain() {
+	s.log.Info("grpc server draining", "pre_stop_delay", s.preStopDelay.String())
+	util.SdStopping(s.log)
+	s.health.Shutdown()
+	api.SetReady(false)
+	time.Sleep(s.preStopDelay)
+}
+
+// gracefulStop waits for in-flight RPCs to finish and stops the server hard once timeout exceeded
+func (s *Server) gracefulStop(timeout time.Duration) error {
+	s.log.Info("grpc server stopping gracefully")
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		s.log.Warn("grpc server forcing stop, closing open streams", "timeout", timeout.String())
+		s.grpc.Stop()
+		return fmt.Errorf("%w: exceeded %s", ErrShutdownTimeout, timeout)
+	}
+	s.log.Info("grpc server stopped")
+	return nil
+}
+
+// AddShutdownHook registers a hook run in order after the server stopped on a
+// signal, e.g. util.LoggerSyncHook or database.CloseHook. Only used by Serve
+// and ServeFromListener, which handle the signals themselves.
+func (s *Server) AddShutdownHook(hook util.ShutdownHook) {
+	s.shutdown.AddHook(hook)
+}
+
 // Tell the server to shutdown
 func (s *Server) Shutdown() {
 	s.shutdown.Expect()
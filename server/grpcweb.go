@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+// grpcWebHandler serves gRPC-Web and gRPC-Web-text requests for the
+// services registered on grpcSrv, see WithGrpcWeb
+func grpcWebHandler(grpcSrv *Server, allowedOrigins []string) gin.HandlerFunc {
+	allowed := originFunc(allowedOrigins)
+	wrapped := grpcweb.WrapServer(grpcSrv.grpc,
+		grpcweb.WithOriginFunc(allowed),
+		grpcweb.WithAllowedRequestHeaders([]string{
+			"content-type", "x-grpc-web", "x-user-agent", "grpc-timeout",
+			logger.CORRELATION_ID.String(),
+			logger.TraceparentHeader,
+			logger.TracestateHeader,
+			logger.BaggageHeader,
+		}),
+	)
+	// Services are registered after the server is built, the methods are listed on the first request
+	var once sync.Once
+	var methods map[string]bool
+	registered := func(path string) bool {
+		once.Do(func() {
+			methods = map[string]bool{}
+			for _, m := range grpcweb.ListGRPCResources(grpcSrv.grpc) {
+				methods[m] = true
+			}
+		})
+		return methods[path]
+	}
+
+	return func(c *gin.Context) {
+		// The content-type alone matches any path, requests for other paths are gin's
+		if !wrapped.IsGrpcWebRequest(c.Request) && !wrapped.IsAcceptableGrpcCorsRequest(c.Request) || !registered(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		// Browsers send the origin of cross-origin and of same-origin POST requests, other clients none
+		if origin := c.GetHeader("Origin"); origin != "" && !sameOrigin(origin, c.Request) && !allowed(origin) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		// Hand the correlation id chosen by the logging handler to the gRPC
+		// server, its interceptor echoes it in the response header again
+		if id := logger.CorrelationID(c.Request.Context()); id != "" {
+			c.Request.Header.Set(logger.CORRELATION_ID.String(), id)
+			c.Writer.Header().Del(logger.CORRELATION_ID.String())
+		}
+		// gin presets 404 for requests without a route, the gRPC-Web response sets no status itself
+		c.Status(http.StatusOK)
+		wrapped.ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+	}
+}
+
+// originFunc allows the cross-origin requests of allowedOrigins
+func originFunc(allowedOrigins []string) func(origin string) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		if o == "*" {
+			return func(string) bool { return true }
+		}
+		allowed[o] = true
+	}
+	return func(origin string) bool { return allowed[origin] }
+}
+
+// sameOrigin reports whether origin is the host req was sent to. The scheme
+// is not compared, TLS may be terminated in front of the server.
+func sameOrigin(origin string, req *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, req.Host)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGrpcWeb(t *testing.T) {
+	grpcSrv := NewGrpcServerWithOptions("grpcweb-test-grpc")
+	rest := NewRestServerWithOptions("grpcweb-test-rest", WithProfile("release"), WithGrpcWeb(grpcSrv, "https://dashboard.example.com"))
+	rest.RegisterService(func(r *gin.Engine) {
+		r.POST("/upload", func(c *gin.Context) { c.String(http.StatusCreated, "gin") })
+	})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rest.ServeContext(ctx, lis)
+	url := "http://" + lis.Addr().String() + "/grpc.health.v1.Health/Check"
+
+	msg, _ := proto.Marshal(&healthpb.HealthCheckRequest{})
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	for _, tc := range []struct {
+		name   string
+		origin string
+		code   int
+	}{
+		{"no origin", "", http.StatusOK},
+		{"same origin", "http://" + lis.Addr().String(), http.StatusOK},
+		{"allowed origin", "https://dashboard.example.com", http.StatusOK},
+		{"other origin", "https://evil.example.com", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(frame))
+			req.Header.Set("Content-Type", "application/grpc-web+proto")
+			req.Header.Set("X-Grpc-Web", "1")
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != tc.code {
+				t.Fatalf("got status %d, want %d", res.StatusCode, tc.code)
+			}
+			if tc.code != http.StatusOK {
+				return
+			}
+			// A message frame followed by the trailer frame
+			if len(body) < 5 || body[0] != 0 {
+				t.Fatalf("unexpected body %q", body)
+			}
+			n := binary.BigEndian.Uint32(body[1:5])
+			resp := &healthpb.HealthCheckResponse{}
+			if err := proto.Unmarshal(body[5:5+n], resp); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+				t.Fatalf("got %v, %v", resp, err)
+			}
+			if trailer := string(body[5+n:]); !strings.Contains(trailer, "grpc-status: 0") {
+				t.Fatalf("unexpected trailer %q", trailer)
+			}
+		})
+	}
+
+	// A grpc-web content-type alone does not divert requests for unregistered paths
+	req, _ := http.NewRequest(http.MethodPost, "http://"+lis.Addr().String()+"/upload", bytes.NewReader(frame))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated || string(body) != "gin" {
+		t.Fatalf("unregistered path: got %d %q", res.StatusCode, body)
+	}
+
+	preflight := func(origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodOptions, url, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	if res := preflight("https://dashboard.example.com"); res.StatusCode >= 300 || res.Header.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" {
+		t.Fatalf("preflight: got %d, allow origin %q", res.StatusCode, res.Header.Get("Access-Control-Allow-Origin"))
+	}
+	if res := preflight("https://evil.example.com"); res.StatusCode != http.StatusForbidden || res.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("preflight of other origin: got %d, allow origin %q", res.StatusCode, res.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Buffer of each direction of an in-process connection
+const inProcessBufferSize = 1 << 20
+
+// InProcessListener connects a server and its clients linked into the same
+// binary through memory instead of the network stack. Serve it with
+// ServeFromListener or ServeContext like any other listener.
+type InProcessListener struct {
+	*bufconn.Listener
+}
+
+// NewInProcessListener returns a listener for in-process connections
+func NewInProcessListener() *InProcessListener {
+	return &InProcessListener{bufconn.Listen(inProcessBufferSize)}
+}
+
+// DialOption makes a gRPC client connect to the listener, whatever its target:
+//
+//	conn, err := server.DialGateway(ctx, "inprocess", lis.DialOption())
+func (l *InProcessListener) DialOption() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return l.DialContext(ctx)
+	})
+}
+
+// HTTPClient returns a client sending all requests to the REST server on the
+// listener, the host of the URLs is ignored
+func (l *InProcessListener) HTTPClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		},
+	}}
+}
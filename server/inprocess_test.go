@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestInProcessListener(t *testing.T) {
+	lis := NewInProcessListener()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewGrpcServer("test-grpc", false).ServeContext(ctx, lis)
+
+	conn, err := DialGateway(ctx, "inprocess", lis.DialOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("got %s", res.Status)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+// Permissions of the unix sockets created by Serve and Run
+const defaultUnixSocketMode os.FileMode = 0660
+
+// listenConfig decides how Serve and Run listen on their address
+type listenConfig struct {
+	// Name of the systemd socket to take, if any
+	systemdSocket string
+	// Permissions of unix sockets
+	unixSocketMode os.FileMode
+	// Sources whose PROXY protocol header is read, none disables it
+	proxyProtocol []*net.IPNet
+}
+
+// listen takes the systemd socket if there is one, otherwise it listens on
+// addr. An address starting with `unix:` is a unix socket path, e.g.
+// unix:/run/janitor/grpc.sock or unix:///run/janitor/grpc.sock, anything
+// else a TCP address.
+func (c listenConfig) listen(addr string, log logger.Logger) (net.Listener, error) {
+	lis, err := c.listenAddr(addr, log)
+	if err != nil || len(c.proxyProtocol) == 0 {
+		return lis, err
+	}
+	return NewProxyProtocolListener(lis, c.proxyProtocol), nil
+}
+
+func (c listenConfig) listenAddr(addr string, log logger.Logger) (net.Listener, error) {
+	if c.systemdSocket != "" {
+		lis, err := SystemdListener(c.systemdSocket)
+		if err != nil {
+			return nil, err
+		}
+		if lis != nil {
+			log.Info("using systemd socket", "socket", c.systemdSocket, "addr", lis.Addr())
+			return lis, nil
+		}
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		return ListenUnix(strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//"), c.unixSocketMode)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ListenUnix listens on the unix socket at path with permissions mode. A
+// stale socket left by a crashed process is removed, a socket another
+// process still serves on is an error. The socket is removed when the
+// listener is closed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+	// The socket is bound in a directory only we may enter and moved to path
+	// once it has mode, others can never connect with the default permissions
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(path))
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The bound path is gone after the rename, unixListener removes path instead
+	ul.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode.Perm()); err != nil {
+		ul.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ul.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: ul, path: path, unlink: true}, nil
+}
+
+// unixListener is a unix socket listener moved to path after the bind
+type unixListener struct {
+	*net.UnixListener
+	path   string
+	unlink bool
+}
+
+// Addr returns path, the address the socket was bound to is gone
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// SetUnlinkOnClose sets whether path is removed when the listener is closed
+func (l *unixListener) SetUnlinkOnClose(unlink bool) {
+	l.unlink = unlink
+}
+
+// Close stops listening and removes path unless disabled with SetUnlinkOnClose
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	if l.unlink {
+		l.unlink = false
+		os.Remove(l.path)
+	}
+	return err
+}
+
+// NewUnixHTTPClient returns a client sending all requests to the REST server
+// on the unix socket at path, the host of the URLs is ignored
+func NewUnixHTTPClient(path string) *http.Client {
+	var d net.Dialer
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
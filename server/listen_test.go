@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+
+	// A socket left by a crashed process
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lis, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("got mode %s", fi.Mode().Perm())
+	}
+	if lis.Addr().String() != path {
+		t.Fatalf("got addr %s", lis.Addr())
+	}
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Fatal("listened on a socket in use")
+	}
+	lis.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket not removed on close: %v", err)
+	}
+}
+
+func TestRestServerRunUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rest.sock")
+	s := NewRestServerWithOptions("test-rest", WithProfile("release"))
+	s.RegisterService(func(r *gin.Engine) {
+		r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx, "unix:"+path)
+
+	client := NewUnixHTTPClient(path)
+	var res *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if res, err = client.Get("http://rest/ping"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	if string(b) != "pong" {
+		t.Fatalf("got %q", b)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/util"
+	"github.com/soheilhy/cmux"
+	"go.uber.org/multierr"
+)
+
+// MuxServer serves a Server and a RestServer on a single port. HTTP/2
+// connections whose first request has content-type application/grpc are
+// handed to the gRPC server, everything else to the gin router.
+type MuxServer struct {
+	grpc *Server
+	rest *RestServer
+	// Logger interface
+	log logger.Logger
+}
+
+type serveResult struct {
+	name string
+	err  error
+}
+
+// NewMuxServer returns a MuxServer multiplexing grpcSrv and restSrv
+func NewMuxServer(name string, grpcSrv *Server, restSrv *RestServer) *MuxServer {
+	return &MuxServer{grpc: grpcSrv, rest: restSrv, log: logger.WithName(name)}
+}
+
+// Run serves both servers on apiAddr until ctx is cancelled, then stops them gracefully
+func (m *MuxServer) Run(ctx context.Context, apiAddr string) error {
+	apiLis, err := m.grpc.listen.listen(apiAddr, m.log)
+	if err != nil {
+		return err
+	}
+	defer apiLis.Close()
+	return m.ServeContext(ctx, apiLis)
+}
+
+// ServeContext serves both servers on apiLis until ctx is cancelled, then
+// stops them gracefully. If either stops serving on its own the other one is
+// stopped as well and an error is returned.
+func (m *MuxServer) ServeContext(ctx context.Context, apiLis net.Listener) error {
+	// Both servers share the connections, the limits of the gRPC server apply
+	apiLis = m.grpc.limits.wrap(apiLis, m.log)
+	mux := cmux.New(apiLis)
+	grpcLis := mux.MatchWithWriters(
+		cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"),
+		cmux.HTTP2MatchHeaderFieldPrefixSendSettings("content-type", "application/grpc+"),
+	)
+	restLis := mux.Match(cmux.Any())
+
+	served := make(chan serveResult, 3)
+	m.log.Info("starting to serve grpc and rest", "addr", apiLis.Addr())
+	util.Ready(ctx)
+	go func() { served <- serveResult{"grpc", m.grpc.grpc.Serve(grpcLis)} }()
+	go func() { served <- serveResult{"rest", m.rest.httpServer.Serve(restLis)} }()
+	go func() { served <- serveResult{"mux", mux.Serve()} }()
+	remaining := 3
+
+	var errs error
+	select {
+	case <-ctx.Done():
+	case res := <-served:
+		remaining--
+		errs = fmt.Errorf("%w: %s serve returned: %v", ErrUnexpectedStop, res.name, res.err)
+	}
+
+	// Report not ready and keep serving for the pre-stop delays
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); m.grpc.drain() }()
+	go func() { defer wg.Done(); m.rest.drain() }()
+	wg.Wait()
+
+	// Stop accepting on the shared listener, then wait for in-flight requests
+	// of both servers. Serve returning because of the closed listener is
+	// expected from here on.
+	apiLis.Close()
+	var mu sync.Mutex
+	for _, stop := range []func() error{
+		func() error { return m.grpc.gracefulStop(m.grpc.shutdownTimeout) },
+		func() error { return m.rest.gracefulStop(m.rest.shutdownTimeout) },
+	} {
+		stop := stop
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stop(); err != nil {
+				mu.Lock()
+				errs = multierr.Append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for ; remaining > 0; remaining-- {
+		<-served
+	}
+	m.log.Info("grpc and rest servers stopped")
+	return errs
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestMuxServerRoutesAndStops(t *testing.T) {
+	grpcSrv := NewGrpcServerWithOptions("mux-test-grpc")
+	restSrv := NewRestServerWithOptions("mux-test-rest", WithProfile("release"))
+	slowStarted := make(chan struct{})
+	restSrv.RegisterService(func(r *gin.Engine) {
+		r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+		r.GET("/slow", func(c *gin.Context) {
+			close(slowStarted)
+			time.Sleep(200 * time.Millisecond)
+			c.String(http.StatusOK, "done")
+		})
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- NewMuxServer("mux-test", grpcSrv, restSrv).ServeContext(ctx, lis) }()
+
+	// gRPC reaches the gRPC server
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("grpc health: %v, %v", resp, err)
+	}
+
+	// HTTP/1 reaches the gin router on the same port
+	get := func(path string) (string, error) {
+		res, err := http.Get("http://" + addr + path)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		return string(b), err
+	}
+	if body, err := get("/ping"); err != nil || body != "pong" {
+		t.Fatalf("rest: %q, %v", body, err)
+	}
+
+	// A request in flight when ctx is cancelled still completes
+	slow := make(chan string, 1)
+	go func() {
+		body, err := get("/slow")
+		if err != nil {
+			body = err.Error()
+		}
+		slow <- body
+	}()
+	<-slowStarted
+	cancel()
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mux server did not stop")
+	}
+	if body := <-slow; body != "done" {
+		t.Fatalf("in-flight request: %q", body)
+	}
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Fatal("listener still accepting")
+	}
+}
+
+func TestMuxServerConnectionLimits(t *testing.T) {
+	grpcSrv := NewGrpcServerWithOptions("mux-test-grpc", WithMaxConnections(1))
+	restSrv := NewRestServerWithOptions("mux-test-rest", WithProfile("release"))
+	restSrv.RegisterService(func(r *gin.Engine) {
+		r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewMuxServer("mux-test", grpcSrv, restSrv).ServeContext(ctx, lis)
+
+	// Keeps its connection open
+	client := &http.Client{Transport: &http.Transport{}}
+	defer client.CloseIdleConnections()
+	res, err := client.Get("http://" + addr + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(res.Body)
+	res.Body.Close()
+
+	second, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	// Closed right after accepting, before the request is read
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := second.Read(make([]byte, 64)); err != io.EOF {
+		t.Fatalf("connection over the limit not closed: read %d bytes, %v", n, err)
+	}
+}
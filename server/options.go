@@ -0,0 +1,422 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/config"
+	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/metrics"
+	"github.com/karthikraman22/rpc-bp/realip"
+	"github.com/karthikraman22/rpc-bp/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Defaults of the REST server timeouts
+const (
+	defaultReadTimeout  = 10 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// keepalive of NewGrpcServer(name, true)
+var defaultKeepalive = keepalive.ServerParameters{
+	MaxConnectionIdle: 5 * time.Minute,
+	Time:              2 * time.Second,
+}
+
+// Option configures a Server or RestServer. Options not applying to the
+// server being built are ignored.
+type Option func(*options)
+
+type options struct {
+	// Shared
+	shutdownTimeout time.Duration
+	preStopDelay    time.Duration
+	shutdown        *util.ShutdownWaitGroup
+	systemdSocket   string
+	unixSocketMode  os.FileMode
+	proxyProtocol   []*net.IPNet
+	trustedProxies  []*net.IPNet
+	maxConns        int
+	maxConnsPerIP   int
+
+	// gRPC
+	keepalive            *keepalive.ServerParameters
+	enforcement          *keepalive.EnforcementPolicy
+	maxRecvMsgSize       int
+	maxSendMsgSize       int
+	maxConcurrentStreams uint32
+	connectionTimeout    time.Duration
+	unaryInterceptors    []grpc.UnaryServerInterceptor
+	streamInterceptors   []grpc.StreamServerInterceptor
+	serverOptions        []grpc.ServerOption
+
+	// REST
+	profile           string
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	metricsPath       string
+	grpcWeb           *Server
+	grpcWebOrigins    []string
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		shutdownTimeout: defaultShutdownTimeout,
+		readTimeout:     defaultReadTimeout,
+		writeTimeout:    defaultWriteTimeout,
+		unixSocketMode:  defaultUnixSocketMode,
+		metricsPath:     metrics.Path,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.shutdown == nil {
+		o.shutdown = util.NewShutdownWaitGroup()
+	}
+	return o
+}
+
+func (o *options) listenConfig() listenConfig {
+	return listenConfig{systemdSocket: o.systemdSocket, unixSocketMode: o.unixSocketMode, proxyProtocol: o.proxyProtocol}
+}
+
+func (o *options) connLimits(name string) connLimits {
+	return connLimits{name: name, maxConns: o.maxConns, maxPerIP: o.maxConnsPerIP}
+}
+
+// WithShutdownTimeout sets the time granted to in-flight requests once a graceful shutdown started (default 30s)
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *options) { o.shutdownTimeout = d }
+}
+
+// WithPreStopDelay sets how long the server keeps accepting requests after it
+// reported not ready, so load balancers notice before the listener closes
+func WithPreStopDelay(d time.Duration) Option {
+	return func(o *options) { o.preStopDelay = d }
+}
+
+// WithShutdownWaitGroup lets Serve and ServeFromListener stop on the signals of
+// shutdown, servers sharing it stop concurrently on the same signal and share
+// its hooks
+func WithShutdownWaitGroup(shutdown *util.ShutdownWaitGroup) Option {
+	return func(o *options) { o.shutdown = shutdown }
+}
+
+// WithSystemdSocket lets Serve and Run take the socket systemd passed under
+// name (FileDescriptorName= of the socket unit) instead of listening themselves
+func WithSystemdSocket(name string) Option {
+	return func(o *options) { o.systemdSocket = name }
+}
+
+// WithUnixSocketMode sets the permissions of the unix socket Serve and Run
+// create for a `unix:` address (default 0660)
+func WithUnixSocketMode(mode os.FileMode) Option {
+	return func(o *options) { o.unixSocketMode = mode }
+}
+
+// WithProxyProtocol makes Serve and Run read the PROXY protocol v1 or v2
+// header of connections from the trusted sources, see NewProxyProtocolListener
+func WithProxyProtocol(trusted ...*net.IPNet) Option {
+	return func(o *options) { o.proxyProtocol = append(o.proxyProtocol, trusted...) }
+}
+
+// WithTrustedProxies sets the proxies allowed to tell the client address with
+// x-forwarded-for and x-forwarded-remote-addr, see realip.NewResolver. The
+// client is in the ctx of each request, realip.FromContext, and logged.
+func WithTrustedProxies(trusted ...*net.IPNet) Option {
+	return func(o *options) { o.trustedProxies = append(o.trustedProxies, trusted...) }
+}
+
+// WithMaxConnections limits the connections open at once, ServeFromListener
+// and ServeContext close further ones right after accepting them
+func WithMaxConnections(n int) Option {
+	return func(o *options) { o.maxConns = n }
+}
+
+// WithMaxConnectionsPerIP limits the connections open at once from each
+// client IP, the client behind the PROXY protocol if it is enabled
+func WithMaxConnectionsPerIP(n int) Option {
+	return func(o *options) { o.maxConnsPerIP = n }
+}
+
+// WithKeepalive sets the gRPC keepalive and connection age parameters
+func WithKeepalive(params keepalive.ServerParameters) Option {
+	return func(o *options) { o.keepalive = &params }
+}
+
+// WithKeepaliveEnforcement sets how often gRPC clients may ping before the connection is closed
+func WithKeepaliveEnforcement(policy keepalive.EnforcementPolicy) Option {
+	return func(o *options) { o.enforcement = &policy }
+}
+
+// WithMaxRecvMsgSize sets the largest gRPC message in bytes the server accepts (grpc default 4MB)
+func WithMaxRecvMsgSize(n int) Option {
+	return func(o *options) { o.maxRecvMsgSize = n }
+}
+
+// WithMaxSendMsgSize sets the largest gRPC message in bytes the server sends
+func WithMaxSendMsgSize(n int) Option {
+	return func(o *options) { o.maxSendMsgSize = n }
+}
+
+// WithMaxConcurrentStreams limits the concurrent gRPC streams of each connection
+func WithMaxConcurrentStreams(n uint32) Option {
+	return func(o *options) { o.maxConcurrentStreams = n }
+}
+
+// WithConnectionTimeout sets the timeout of the gRPC connection setup (grpc default 120s)
+func WithConnectionTimeout(d time.Duration) Option {
+	return func(o *options) { o.connectionTimeout = d }
+}
+
+// WithUnaryInterceptors adds gRPC unary interceptors, they run after tracing, metrics and the client resolution and before logging
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(o *options) { o.unaryInterceptors = append(o.unaryInterceptors, interceptors...) }
+}
+
+// WithStreamInterceptors adds gRPC stream interceptors, they run after tracing, metrics and the client resolution and before logging
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(o *options) { o.streamInterceptors = append(o.streamInterceptors, interceptors...) }
+}
+
+// WithServerOptions passes any grpc.ServerOption to the gRPC server, they are applied last
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(o *options) { o.serverOptions = append(o.serverOptions, opts...) }
+}
+
+// WithProfile sets the gin mode, release or debug
+func WithProfile(profile string) Option {
+	return func(o *options) { o.profile = profile }
+}
+
+// WithReadTimeout sets the time to read a whole REST request (default 10s)
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) { o.readTimeout = d }
+}
+
+// WithReadHeaderTimeout sets the time to read the headers of a REST request
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(o *options) { o.readHeaderTimeout = d }
+}
+
+// WithWriteTimeout sets the time to write a REST response (default 10s)
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) { o.writeTimeout = d }
+}
+
+// WithIdleTimeout sets how long idle REST keep-alive connections are kept open
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.idleTimeout = d }
+}
+
+// WithMaxHeaderBytes limits the size of the REST request headers (http default 1MB)
+func WithMaxHeaderBytes(n int) Option {
+	return func(o *options) { o.maxHeaderBytes = n }
+}
+
+// WithMetricsPath serves the metrics of metrics.Registry on path instead of
+// metrics.Path, "" does not serve them, e.g. if metrics.ListenAndServe serves
+// them on an internal port
+func WithMetricsPath(path string) Option {
+	return func(o *options) { o.metricsPath = path }
+}
+
+// WithGrpcWeb serves gRPC-Web and gRPC-Web-text requests, and their CORS
+// preflights, for the methods registered on grpcSrv from the gin router ahead
+// of all routes. Pages served from the same host may always call them, other
+// origins only if listed in allowedOrigins, "*" allows any origin. Requests
+// of other origins are refused with 403. Requests for paths that are no
+// registered method are routed by gin as before.
+func WithGrpcWeb(grpcSrv *Server, allowedOrigins ...string) Option {
+	return func(o *options) {
+		o.grpcWeb = grpcSrv
+		o.grpcWebOrigins = allowedOrigins
+	}
+}
+
+// GrpcOptionsFromConfig reads the options of the `server.grpc` section of the config
+func GrpcOptionsFromConfig(cfg *config.Config) []Option {
+	opts := []Option{}
+	// keepalive also exists with only the enforcement policy set
+	if anyExists(cfg, "server.grpc.keepalive.", "maxconnectionidle", "maxconnectionage", "maxconnectionagegrace", "time", "timeout") {
+		opts = append(opts, WithKeepalive(keepalive.ServerParameters{
+			MaxConnectionIdle:     cfg.Duration("server.grpc.keepalive.maxconnectionidle"),
+			MaxConnectionAge:      cfg.Duration("server.grpc.keepalive.maxconnectionage"),
+			MaxConnectionAgeGrace: cfg.Duration("server.grpc.keepalive.maxconnectionagegrace"),
+			Time:                  cfg.Duration("server.grpc.keepalive.time"),
+			Timeout:               cfg.Duration("server.grpc.keepalive.timeout"),
+		}))
+	}
+	if cfg.Exists("server.grpc.keepalive.enforcement") {
+		opts = append(opts, WithKeepaliveEnforcement(keepalive.EnforcementPolicy{
+			MinTime:             cfg.Duration("server.grpc.keepalive.enforcement.mintime"),
+			PermitWithoutStream: cfg.Bool("server.grpc.keepalive.enforcement.permitwithoutstream"),
+		}))
+	}
+	if n := cfg.Int("server.grpc.maxrecvmsgsize"); n > 0 {
+		opts = append(opts, WithMaxRecvMsgSize(n))
+	}
+	if n := cfg.Int("server.grpc.maxsendmsgsize"); n > 0 {
+		opts = append(opts, WithMaxSendMsgSize(n))
+	}
+	if n := cfg.Int("server.grpc.maxconcurrentstreams"); n > 0 {
+		opts = append(opts, WithMaxConcurrentStreams(uint32(n)))
+	}
+	if d := cfg.Duration("server.grpc.connectiontimeout"); d > 0 {
+		opts = append(opts, WithConnectionTimeout(d))
+	}
+	if d := cfg.Duration("server.grpc.shutdowntimeout"); d > 0 {
+		opts = append(opts, WithShutdownTimeout(d))
+	}
+	if d := cfg.Duration("server.grpc.prestopdelay"); d > 0 {
+		opts = append(opts, WithPreStopDelay(d))
+	}
+	if name := cfg.String("server.grpc.systemdsocket"); name != "" {
+		opts = append(opts, WithSystemdSocket(name))
+	}
+	if mode, ok := unixSocketModeFromConfig(cfg, "server.grpc.unixsocketmode"); ok {
+		opts = append(opts, WithUnixSocketMode(mode))
+	}
+	if opt := proxyProtocolFromConfig(cfg, "server.grpc.proxyprotocol"); opt != nil {
+		opts = append(opts, opt)
+	}
+	if opt := trustedProxiesFromConfig(cfg, "server.grpc.trustedproxies"); opt != nil {
+		opts = append(opts, opt)
+	}
+	if n := cfg.Int("server.grpc.maxconnections"); n > 0 {
+		opts = append(opts, WithMaxConnections(n))
+	}
+	if n := cfg.Int("server.grpc.maxconnectionsperip"); n > 0 {
+		opts = append(opts, WithMaxConnectionsPerIP(n))
+	}
+	return opts
+}
+
+// RestOptionsFromConfig reads the options of the `server.rest` section and the profile of the config
+func RestOptionsFromConfig(cfg *config.Config) []Option {
+	opts := []Option{}
+	if p := cfg.String("profile"); p != "" {
+		opts = append(opts, WithProfile(p))
+	}
+	if d := cfg.Duration("server.rest.readtimeout"); d > 0 {
+		opts = append(opts, WithReadTimeout(d))
+	}
+	if d := cfg.Duration("server.rest.readheadertimeout"); d > 0 {
+		opts = append(opts, WithReadHeaderTimeout(d))
+	}
+	if d := cfg.Duration("server.rest.writetimeout"); d > 0 {
+		opts = append(opts, WithWriteTimeout(d))
+	}
+	if d := cfg.Duration("server.rest.idletimeout"); d > 0 {
+		opts = append(opts, WithIdleTimeout(d))
+	}
+	if n := cfg.Int("server.rest.maxheaderbytes"); n > 0 {
+		opts = append(opts, WithMaxHeaderBytes(n))
+	}
+	// An empty path disables the endpoint
+	if cfg.Exists("server.rest.metricspath") {
+		opts = append(opts, WithMetricsPath(cfg.String("server.rest.metricspath")))
+	}
+	if d := cfg.Duration("server.rest.shutdowntimeout"); d > 0 {
+		opts = append(opts, WithShutdownTimeout(d))
+	}
+	if d := cfg.Duration("server.rest.prestopdelay"); d > 0 {
+		opts = append(opts, WithPreStopDelay(d))
+	}
+	if name := cfg.String("server.rest.systemdsocket"); name != "" {
+		opts = append(opts, WithSystemdSocket(name))
+	}
+	if mode, ok := unixSocketModeFromConfig(cfg, "server.rest.unixsocketmode"); ok {
+		opts = append(opts, WithUnixSocketMode(mode))
+	}
+	if opt := proxyProtocolFromConfig(cfg, "server.rest.proxyprotocol"); opt != nil {
+		opts = append(opts, opt)
+	}
+	if opt := trustedProxiesFromConfig(cfg, "server.rest.trustedproxies"); opt != nil {
+		opts = append(opts, opt)
+	}
+	if n := cfg.Int("server.rest.maxconnections"); n > 0 {
+		opts = append(opts, WithMaxConnections(n))
+	}
+	if n := cfg.Int("server.rest.maxconnectionsperip"); n > 0 {
+		opts = append(opts, WithMaxConnectionsPerIP(n))
+	}
+	return opts
+}
+
+// unixSocketModeFromConfig reads the permissions at key, either an octal
+// string like "0660" or the number yaml makes of an unquoted 0660
+func unixSocketModeFromConfig(cfg *config.Config, key string) (os.FileMode, bool) {
+	if !cfg.Exists(key) {
+		return 0, false
+	}
+	var mode uint64
+	var err error
+	switch v := cfg.Get(key).(type) {
+	case string:
+		mode, err = strconv.ParseUint(v, 8, 32)
+	case int:
+		mode = uint64(v)
+	case int64:
+		mode = uint64(v)
+	default:
+		err = fmt.Errorf("unexpected type %T", v)
+	}
+	// 660 without the leading 0 is read as decimal and gets other bits
+	if err == nil && mode&^0777 != 0 {
+		err = fmt.Errorf("mode %#o has bits outside 0777, quote octal modes", mode)
+	}
+	if err != nil {
+		logger.WithName("server").Error(err, "invalid unix socket mode", "key", key)
+		return 0, false
+	}
+	return os.FileMode(mode), true
+}
+
+// anyExists reports whether any of prefix+key is set
+func anyExists(cfg *config.Config, prefix string, keys ...string) bool {
+	for _, key := range keys {
+		if cfg.Exists(prefix + key) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyProtocolFromConfig reads the trusted sources of the PROXY protocol at key
+func proxyProtocolFromConfig(cfg *config.Config, key string) Option {
+	if trusted := cidrsFromConfig(cfg, key); len(trusted) > 0 {
+		return WithProxyProtocol(trusted...)
+	}
+	return nil
+}
+
+// trustedProxiesFromConfig reads the trusted proxies at key
+func trustedProxiesFromConfig(cfg *config.Config, key string) Option {
+	if trusted := cidrsFromConfig(cfg, key); len(trusted) > 0 {
+		return WithTrustedProxies(trusted...)
+	}
+	return nil
+}
+
+// cidrsFromConfig reads the list of CIDRs at key, invalid entries are logged and left out
+func cidrsFromConfig(cfg *config.Config, key string) []*net.IPNet {
+	var trusted []*net.IPNet
+	for _, cidr := range cfg.Strings(key) {
+		n, err := realip.ParseCIDRs(cidr)
+		if err != nil {
+			logger.WithName("server").Error(err, "invalid CIDR", "key", key)
+			continue
+		}
+		trusted = append(trusted, n...)
+	}
+	return trusted
+}
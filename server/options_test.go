@@ -0,0 +1,82 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/config"
+	"google.golang.org/grpc/keepalive"
+)
+
+func loadConfig(t *testing.T, fname string) *config.Config {
+	t.Helper()
+	cfg, err := config.NewConfig(fname, "RPCBP_TEST_")
+	if err != nil {
+		t.Fatalf("load %s: %v", fname, err)
+	}
+	return cfg
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	cfg := loadConfig(t, "../test-conf.yaml")
+
+	o := newOptions(GrpcOptionsFromConfig(cfg))
+	wantKeepalive := keepalive.ServerParameters{MaxConnectionIdle: 5 * time.Minute, Time: 2 * time.Second, Timeout: 20 * time.Second}
+	if o.keepalive == nil || *o.keepalive != wantKeepalive {
+		t.Fatalf("keepalive: got %+v", o.keepalive)
+	}
+	if want := (keepalive.EnforcementPolicy{MinTime: time.Second, PermitWithoutStream: true}); o.enforcement == nil || *o.enforcement != want {
+		t.Fatalf("enforcement: got %+v", o.enforcement)
+	}
+	if o.maxRecvMsgSize != 4194304 || o.maxConcurrentStreams != 1000 || o.shutdownTimeout != 30*time.Second || o.preStopDelay != 5*time.Second {
+		t.Fatalf("grpc options: got %+v", o)
+	}
+
+	o = newOptions(RestOptionsFromConfig(cfg))
+	if o.profile != "release" || o.readTimeout != 10*time.Second || o.readHeaderTimeout != 5*time.Second ||
+		o.writeTimeout != 10*time.Second || o.idleTimeout != 2*time.Minute || o.shutdownTimeout != 30*time.Second || o.preStopDelay != 5*time.Second {
+		t.Fatalf("rest options: got %+v", o)
+	}
+}
+
+func TestKeepaliveEnforcementOnlyFromConfig(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "conf.yaml")
+	conf := "server:\n  grpc:\n    keepalive:\n      enforcement:\n        mintime: 10s\n"
+	if err := os.WriteFile(fname, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	o := newOptions(GrpcOptionsFromConfig(loadConfig(t, fname)))
+	// Zero keepalive parameters would turn off the grpc defaults
+	if o.keepalive != nil {
+		t.Fatalf("keepalive set to %+v", *o.keepalive)
+	}
+	if o.enforcement == nil || o.enforcement.MinTime != 10*time.Second {
+		t.Fatalf("enforcement: got %+v", o.enforcement)
+	}
+}
+
+func TestUnixSocketModeFromConfig(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "conf.yaml")
+	for _, tc := range []struct {
+		value string
+		want  os.FileMode
+	}{
+		{"0600", 0600},
+		{`"0600"`, 0600},
+		{`"600"`, 0600},
+		// Decimal 600 is 01130, the default is kept
+		{"600", defaultUnixSocketMode},
+		{`"rw-rw----"`, defaultUnixSocketMode},
+	} {
+		conf := "server:\n  grpc:\n    unixsocketmode: " + tc.value + "\n"
+		if err := os.WriteFile(fname, []byte(conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if o := newOptions(GrpcOptionsFromConfig(loadConfig(t, fname))); o.unixSocketMode != tc.want {
+			t.Fatalf("%s: got %#o, want %#o", tc.value, o.unixSocketMode, tc.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/karthikraman22/rpc-bp/realip"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := func(cmd byte, fam byte, addrs []byte) string {
+		b := append([]byte{}, proxyV2Signature...)
+		b = append(b, 0x20|cmd, fam, 0, 0)
+		binary.BigEndian.PutUint16(b[14:], uint16(len(addrs)))
+		return string(append(b, addrs...))
+	}
+	ipv4 := []byte{203, 0, 113, 7, 10, 0, 0, 1, 0xdc, 0x04, 0x01, 0xbb}
+
+	for _, tc := range []struct {
+		name, in, remote, rest string
+		err                    bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\nGET", "203.0.113.7:56324", "GET", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::7 2001:db8::1 56324 443\r\nGET", "[2001:db8::7]:56324", "GET", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\nGET", "", "GET", false},
+		{"v1 invalid", "PROXY TCP4 nope 10.0.0.1 56324 443\r\nGET", "", "", true},
+		{"v2 tcp4", v2(1, 0x11, ipv4) + "GET", "203.0.113.7:56324", "GET", false},
+		{"v2 local", v2(0, 0x00, nil) + "GET", "", "GET", false},
+		{"v2 short", v2(1, 0x21, ipv4) + "GET", "", "", true},
+		{"no header", "POST / HTTP/1.1\r\n", "", "POST / HTTP/1.1\r\n", false},
+	} {
+		r := bufio.NewReader(strings.NewReader(tc.in))
+		remote, _, err := readProxyHeader(r)
+		if (err != nil) != tc.err {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if tc.err {
+			continue
+		}
+		if got := ""; remote != nil {
+			got = remote.String()
+			if got != tc.remote {
+				t.Fatalf("%s: got remote %s, want %s", tc.name, got, tc.remote)
+			}
+		} else if tc.remote != "" {
+			t.Fatalf("%s: no remote, want %s", tc.name, tc.remote)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != tc.rest {
+			t.Fatalf("%s: got rest %q", tc.name, rest)
+		}
+	}
+}
+
+func TestRestServerProxyProtocol(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewRestServerWithOptions("test-rest", WithProfile("release"))
+	s.RegisterService(func(r *gin.Engine) {
+		r.GET("/addr", func(c *gin.Context) { c.String(http.StatusOK, c.Request.RemoteAddr) })
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	trusted, err := realip.ParseCIDRs("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeContext(ctx, NewProxyProtocolListener(lis, trusted))
+
+	get := func(header string) string {
+		conn, err := net.DialTimeout("tcp", lis.Addr().String(), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write([]byte(header + "GET /addr HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n"))
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return string(b)
+	}
+	if got := get("PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\n"); got != "203.0.113.7:56324" {
+		t.Fatalf("got %s behind the proxy", got)
+	}
+	if got := get(""); !strings.HasPrefix(got, "127.0.0.1:") {
+		t.Fatalf("got %s without header", got)
+	}
+
+	// Headers of untrusted sources are not read
+	lis.Close()
+	lis, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, _ := realip.ParseCIDRs("10.0.0.0/8")
+	go NewRestServerWithOptions("test-rest", WithProfile("release")).ServeContext(ctx, NewProxyProtocolListener(lis, untrusted))
+	conn, err := net.DialTimeout("tcp", lis.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\nGET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %d for an untrusted header", res.StatusCode)
+	}
+}
@@ -8,8 +8,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/karthikraman22/rpc-bp/config"
+	api "github.com/karthikraman22/rpc-bp/health"
 	"github.com/karthikraman22/rpc-bp/logger"
+	"github.com/karthikraman22/rpc-bp/metrics"
+	"github.com/karthikraman22/rpc-bp/realip"
 	"github.com/karthikraman22/rpc-bp/util"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Server is the implementation of an API Server
@@ -22,6 +27,14 @@ type RestServer struct {
 	log logger.Logger
 	//
 	shutdown *util.ShutdownWaitGroup
+	// Time granted to in-flight requests once a graceful shutdown started
+	shutdownTimeout time.Duration
+	// How Serve and Run listen on their address
+	listen listenConfig
+	// Connections ServeFromListener and ServeContext accept
+	limits connLimits
+	// Time the server keeps serving after the readiness probe failed
+	preStopDelay time.Duration
 }
 
 // ServiceRegistrar wraps a single method that supports service registration.
@@ -33,18 +46,51 @@ type RestServiceRegistrar interface {
 
 // NewServer returns a new configured instance of Server
 func NewRestServer(name, profile string, keepAlive bool) *RestServer {
+	return NewRestServerWithOptions(name, WithProfile(profile))
+}
 
-	gin.SetMode(profile)
+// NewRestServerFromConfig returns a RestServer configured by the profile and
+// the `server.rest` section of cfg, opts take precedence over the config
+func NewRestServerFromConfig(name string, cfg *config.Config, opts ...Option) *RestServer {
+	return NewRestServerWithOptions(name, append(RestOptionsFromConfig(cfg), opts...)...)
+}
 
-	router := gin.Default()
+// NewRestServerWithOptions returns a new configured instance of RestServer
+func NewRestServerWithOptions(name string, opts ...Option) *RestServer {
+	o := newOptions(opts)
+	if o.profile != "" {
+		gin.SetMode(o.profile)
+	}
+
+	log := logger.WithName(name)
+	router := gin.New()
+	// c.ClientIP() trusts the same proxies as the logs
+	resolver := realip.NewResolver(o.trustedProxies...)
+	trusted := make([]string, 0, len(resolver.Trusted()))
+	for _, n := range resolver.Trusted() {
+		trusted = append(trusted, n.String())
+	}
+	if err := router.SetTrustedProxies(trusted); err != nil {
+		log.Error(err, "invalid trusted proxies")
+	}
+	router.Use(otelgin.Middleware(name), metrics.GinMiddleware(name), realip.GinMiddleware(resolver), logger.GinLoggingHandler(log), gin.Recovery())
+	if o.grpcWeb != nil {
+		router.Use(grpcWebHandler(o.grpcWeb, o.grpcWebOrigins))
+	}
+	if o.metricsPath != "" {
+		router.GET(o.metricsPath, gin.WrapH(metrics.Handler()))
+	}
 
 	httpSrv := &http.Server{
-		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Handler:           router,
+		ReadTimeout:       o.readTimeout,
+		ReadHeaderTimeout: o.readHeaderTimeout,
+		WriteTimeout:      o.writeTimeout,
+		IdleTimeout:       o.idleTimeout,
+		MaxHeaderBytes:    o.maxHeaderBytes,
 	}
 
-	return &RestServer{log: logger.WithName(name), httpServer: httpSrv, router: router, shutdown: util.NewShutdownWaitGroup()}
+	return &RestServer{log: log, httpServer: httpSrv, router: router, shutdown: o.shutdown, shutdownTimeout: o.shutdownTimeout, preStopDelay: o.preStopDelay, listen: o.listenConfig(), limits: o.connLimits(name)}
 }
 
 func (s *RestServer) RegisterService(f func(*gin.Engine)) {
@@ -54,7 +100,7 @@ func (s *RestServer) RegisterService(f func(*gin.Engine)) {
 // Serve starts the api listeners of the Server
 func (s *RestServer) Serve(apiAddr string) error {
 	// Setup listener
-	apiLis, err := net.Listen("tcp", apiAddr)
+	apiLis, err := s.listen.listen(apiAddr, s.log)
 	if err != nil {
 		return err
 	}
@@ -64,28 +110,109 @@ func (s *RestServer) Serve(apiAddr string) error {
 
 // ServeFromListener starts the api listeners of the Server
 func (s *RestServer) ServeFromListener(apiLis net.Listener) error {
+	apiLis = s.limits.wrap(apiLis, s.log)
 	shutdown := s.shutdown
 
 	// Start routine waiting for signals
+	stopErr := make(chan error, 1)
 	shutdown.RegisterSignalHandler(func() {
 		//  gRPC server
-		s.log.Info("rest server stopping gracefully")
-		s.httpServer.Shutdown(context.Background())
+		s.drain()
+		stopErr <- s.gracefulStop(s.shutdownTimeout)
 	})
 
 	s.log.Info("starting to serve rest", "addr", apiLis.Addr())
+	// READY=1 once per process, with several servers app.App sends it once all started
+	defer util.SdServing(s.log)()
 	err := s.httpServer.Serve(apiLis)
 	s.log.Info("rest server stopped")
 
 	// Check if we are expecting shutdown
 	if !shutdown.IsExpected() {
-		panic(fmt.Sprintf("shutdown unexpected, rest serve returned: %v", err))
+		return fmt.Errorf("%w: rest serve returned: %v", ErrUnexpectedStop, err)
 	}
 	// Wait for both shutdown signals and close the channel
-	if ok := shutdown.WaitOrTimeout(30 * time.Second); !ok {
-		panic("shutting down gracefully exceeded 30 seconds")
+	timeout := s.preStopDelay + s.shutdownTimeout + shutdown.ShutdownHooks.Timeout()
+	if ok := shutdown.WaitOrTimeout(timeout); !ok {
+		return fmt.Errorf("%w: exceeded %s", ErrShutdownTimeout, timeout)
 	}
-	return err // Return the error, if grpc stopped gracefully there is no error
+	select {
+	case err := <-stopErr:
+		return err
+	default:
+	}
+	return nil
+}
+
+// Run serves on apiAddr until ctx is cancelled, then stops gracefully. Unlike
+// Serve it leaves signal handling to the caller, e.g. app.App.
+func (s *RestServer) Run(ctx context.Context, apiAddr string) error {
+	apiLis, err := s.listen.listen(apiAddr, s.log)
+	if err != nil {
+		return err
+	}
+	defer apiLis.Close()
+	return s.ServeContext(ctx, apiLis)
+}
+
+// ServeContext serves on apiLis until ctx is cancelled, then stops gracefully.
+// It returns an error if serving stopped without ctx being cancelled. Once
+// serving it calls util.Ready(ctx), app.App reports the process ready to
+// systemd when all its servers did.
+func (s *RestServer) ServeContext(ctx context.Context, apiLis net.Listener) error {
+	apiLis = s.limits.wrap(apiLis, s.log)
+	served := make(chan error, 1)
+	s.log.Info("starting to serve rest", "addr", apiLis.Addr())
+	// apiLis is bound, app.App waits for this before reporting ready
+	util.Ready(ctx)
+	go func() {
+		served <- s.httpServer.Serve(apiLis)
+	}()
+
+	select {
+	case err := <-served:
+		s.log.Info("rest server stopped")
+		return fmt.Errorf("%w: rest serve returned: %v", ErrUnexpectedStop, err)
+	case <-ctx.Done():
+	}
+
+	s.drain()
+	if err := s.gracefulStop(s.shutdownTimeout); err != nil {
+		return err
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// drain fails the readiness probe, then keeps serving for the pre-stop delay so load balancers move away
+func (s *RestServer) drain() {
+	s.log.Info("rest server draining", "pre_stop_delay", s.preStopDelay.String())
+	util.SdStopping(s.log)
+	api.SetReady(false)
+	time.Sleep(s.preStopDelay)
+}
+
+// gracefulStop waits for in-flight requests to finish and closes all connections once timeout exceeded
+func (s *RestServer) gracefulStop(timeout time.Duration) error {
+	s.log.Info("rest server stopping gracefully")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.log.Warn("rest server forcing stop, closing open connections", "timeout", timeout.String())
+		s.httpServer.Close()
+		return fmt.Errorf("%w: exceeded %s: %v", ErrShutdownTimeout, timeout, err)
+	}
+	s.log.Info("rest server stopped")
+	return nil
+}
+
+// AddShutdownHook registers a hook run in order after the server stopped on a
+// signal, e.g. util.LoggerSyncHook or database.CloseHook. Only used by Serve
+// and ServeFromListener, which handle the signals themselves.
+func (s *RestServer) AddShutdownHook(hook util.ShutdownHook) {
+	s.shutdown.AddHook(hook)
 }
 
 // Tell the server to shutdown
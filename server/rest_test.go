@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRestServerMetricsPath(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want map[string]int
+	}{
+		{"default", nil, map[string]int{"/metrics": http.StatusOK}},
+		{"moved", []Option{WithMetricsPath("/internal/metrics")}, map[string]int{"/metrics": http.StatusNotFound, "/internal/metrics": http.StatusOK}},
+		{"disabled", []Option{WithMetricsPath("")}, map[string]int{"/metrics": http.StatusNotFound}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewRestServerWithOptions("metrics-test", append(tc.opts, WithProfile("release"))...)
+			for path, code := range tc.want {
+				rec := httptest.NewRecorder()
+				s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != code {
+					t.Fatalf("GET %s: got %d, want %d", path, rec.Code, code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+// RestartPolicy decides if and when Supervise restarts a failed server
+type RestartPolicy struct {
+	// MaxRestarts in a row before giving up, 0 restarts forever
+	MaxRestarts int
+	// InitialBackoff before the first restart, doubled for every further one (default 100ms)
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff (default 30s)
+	MaxBackoff time.Duration
+	// ResetAfter is how long a run must last to reset the backoff and restart count (default 1m)
+	ResetAfter time.Duration
+}
+
+// DefaultRestartPolicy restarts forever with a backoff from 100ms up to 30s
+var DefaultRestartPolicy = RestartPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	ResetAfter:     time.Minute,
+}
+
+// Supervise calls run until ctx is cancelled, restarting it with backoff when
+// it fails, typically when its listener failed and it returned
+// ErrUnexpectedStop. A failed graceful shutdown (ErrShutdownTimeout) is not
+// restarted. run must listen anew on every call, e.g. Server.Run or
+// RestServer.Run. MuxServer cannot be restarted as it stops both servers.
+func Supervise(ctx context.Context, name string, policy RestartPolicy, run func(ctx context.Context) error) error {
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRestartPolicy.InitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRestartPolicy.MaxBackoff
+	}
+	if policy.ResetAfter <= 0 {
+		policy.ResetAfter = DefaultRestartPolicy.ResetAfter
+	}
+
+	log := logger.WithName(name)
+	backoff := policy.InitialBackoff
+	restarts := 0
+	for {
+		start := time.Now()
+		err := run(ctx)
+		if err == nil || ctx.Err() != nil || errors.Is(err, ErrShutdownTimeout) {
+			return err
+		}
+		if time.Since(start) >= policy.ResetAfter {
+			backoff, restarts = policy.InitialBackoff, 0
+		}
+		if policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts {
+			log.Error(err, "server failed, giving up", "restarts", restarts)
+			return err
+		}
+		restarts++
+		log.Error(err, "server failed, restarting", "restart", restarts, "backoff", backoff.String())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/karthikraman22/rpc-bp/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// failingListener fails Accept like a listener closed underneath the server
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("listener broke")
+}
+
+func TestServeContextUnexpectedStop(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	err = NewGrpcServer("test-grpc", false).ServeContext(context.Background(), failingListener{lis})
+	if !errors.Is(err, ErrUnexpectedStop) {
+		t.Fatalf("grpc: unexpected error %v", err)
+	}
+	err = NewRestServer("test-rest", "release", false).ServeContext(context.Background(), failingListener{lis})
+	if !errors.Is(err, ErrUnexpectedStop) {
+		t.Fatalf("rest: unexpected error %v", err)
+	}
+}
+
+func TestServeContextShutdownTimeout(t *testing.T) {
+	s := NewGrpcServerWithOptions("test-grpc", WithShutdownTimeout(50*time.Millisecond))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.ServeContext(ctx, lis) }()
+
+	// A watch stream stays open until the server is forced to stop
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	watch, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := <-served; !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestServeFromListenerUnexpectedStop(t *testing.T) {
+	shutdown := util.NewShutdownWaitGroup(syscall.SIGUSR2)
+	defer shutdown.Stop()
+	for name, serve := range map[string]func(net.Listener) error{
+		"grpc": NewGrpcServerWithOptions("test-grpc", WithShutdownWaitGroup(shutdown)).ServeFromListener,
+		"rest": NewRestServerWithOptions("test-rest", WithProfile("release"), WithShutdownWaitGroup(shutdown)).ServeFromListener,
+	} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		served := make(chan error, 1)
+		go func() { served <- serve(lis) }()
+		waitServing(t, lis.Addr().String())
+
+		// The listener is closed underneath the running server, no signal was received
+		lis.Close()
+		select {
+		case err := <-served:
+			if !errors.Is(err, ErrUnexpectedStop) {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: still serving", name)
+		}
+	}
+}
+
+func TestServeFromListenerShutdownTimeout(t *testing.T) {
+	// grpc: a watch stream stays open until the server is forced to stop
+	shutdown := util.NewShutdownWaitGroup(syscall.SIGUSR2)
+	defer shutdown.Stop()
+	s := NewGrpcServerWithOptions("test-grpc", WithShutdownTimeout(50*time.Millisecond), WithShutdownWaitGroup(shutdown))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.ServeFromListener(lis) }()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	watch, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("grpc: unexpected error %v", err)
+	}
+	// Stop listening, the next signal would be its second one
+	shutdown.Stop()
+
+	// rest: a request blocks until the server is forced to stop
+	shutdown = util.NewShutdownWaitGroup(syscall.SIGUSR2)
+	defer shutdown.Stop()
+	rest := NewRestServerWithOptions("test-rest", WithProfile("release"), WithShutdownTimeout(50*time.Millisecond), WithShutdownWaitGroup(shutdown))
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	rest.RegisterService(func(r *gin.Engine) {
+		r.GET("/slow", func(c *gin.Context) {
+			close(started)
+			<-release
+		})
+	})
+	lis, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { served <- rest.ServeFromListener(lis) }()
+	go http.Get("http://" + lis.Addr().String() + "/slow")
+	<-started
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("rest: unexpected error %v", err)
+	}
+}
+
+// waitServing waits until addr accepts connections
+func waitServing(t *testing.T, addr string) {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s not serving", addr)
+}
+
+func TestSuperviseRestarts(t *testing.T) {
+	policy := RestartPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	calls := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := Supervise(ctx, "test-supervisor", policy, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return ErrUnexpectedStop
+		}
+		cancel()
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("unexpected result %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	policy.MaxRestarts = 2
+	err = Supervise(context.Background(), "test-supervisor", policy, func(ctx context.Context) error {
+		calls++
+		return ErrUnexpectedStop
+	})
+	if !errors.Is(err, ErrUnexpectedStop) || calls != 3 {
+		t.Fatalf("unexpected result %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = Supervise(context.Background(), "test-supervisor", policy, func(ctx context.Context) error {
+		calls++
+		return ErrShutdownTimeout
+	})
+	if !errors.Is(err, ErrShutdownTimeout) || calls != 1 {
+		t.Fatalf("unexpected result %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fd of the first socket passed by systemd (SD_LISTEN_FDS_START)
+const listenFdsStart = 3
+
+type systemdFile struct {
+	name string
+	file *os.File
+}
+
+// systemdSockets are the sockets systemd passed to the process, starting at fd start
+type systemdSockets struct {
+	start int
+	once  sync.Once
+	mu    sync.Mutex
+	files []systemdFile
+}
+
+var sdSockets = &systemdSockets{start: listenFdsStart}
+
+// take takes the sockets systemd passed to this process, the variables are
+// unset so child processes do not take them as well
+func (s *systemdSockets) take() {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		// systemd names sockets without FileDescriptorName= "unknown"
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		s.files = append(s.files, systemdFile{name, os.NewFile(uintptr(s.start+i), name)})
+	}
+}
+
+func (s *systemdSockets) listener(name string) (net.Listener, error) {
+	s.once.Do(s.take)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.files {
+		if name != "" && f.name != name {
+			continue
+		}
+		s.files = append(s.files[:i], s.files[i+1:]...)
+		// The listener uses a dup of the fd, the original one is closed
+		defer f.file.Close()
+		return net.FileListener(f.file)
+	}
+	return nil, nil
+}
+
+// SystemdListener takes the socket systemd passed under name, the
+// FileDescriptorName= of the socket unit, "" takes the first one. It returns
+// nil if systemd passed no such socket, every socket is taken only once.
+func SystemdListener(name string) (net.Listener, error) {
+	return sdSockets.listener(name)
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestSystemdListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	f, err := lis.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pass a copy of the socket like systemd does, at a free fd instead of 3
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sockets := &systemdSockets{start: fd}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "grpc")
+
+	if got, err := sockets.listener("rest"); got != nil || err != nil {
+		t.Fatalf("got %v, %v for a socket systemd did not pass", got, err)
+	}
+	got, err := sockets.listener("grpc")
+	if err != nil || got == nil {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	defer got.Close()
+	if got.Addr().String() != lis.Addr().String() {
+		t.Fatalf("got %s, want %s", got.Addr(), lis.Addr())
+	}
+	if again, _ := sockets.listener("grpc"); again != nil {
+		t.Fatal("socket taken twice")
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("LISTEN_FDS not unset")
+	}
+}
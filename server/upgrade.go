@@ -0,0 +1,237 @@
+//go:build !windows
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+const (
+	// Names of the inherited listeners in fd order, set for the new process only
+	upgradeFdsEnv = "RPCBP_UPGRADE_FDS"
+	// fd of the pipe the new process reports its readiness on, the listeners follow
+	upgradeReadyFd = 3
+	// Time the new process gets to report ready before the upgrade is aborted
+	upgradeReadyTimeout = 30 * time.Second
+)
+
+// Upgrader hands the listening sockets over to a new process of the same
+// binary on SIGUSR2. The new process inherits them as file descriptors and
+// serves on them, while the old process drains through its usual graceful
+// shutdown, so no connection is refused during the upgrade.
+type Upgrader struct {
+	mu sync.Mutex
+	// Listeners passed by the previous process, by name
+	inherited map[string]*os.File
+	// Listeners handed to the next process, in fd order
+	names     []string
+	listeners map[string]net.Listener
+	// Pipe to the previous process, nil if not started by an upgrade
+	ready *os.File
+	// Closed once a new process took over
+	upgraded chan struct{}
+	// Binary and arguments of the new process, os.Executable and os.Args by default
+	exe  string
+	args []string
+	// Logger interface
+	log logger.Logger
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// unlinker is implemented by unix socket listeners removing their socket on close
+type unlinker interface {
+	SetUnlinkOnClose(unlink bool)
+}
+
+// NewUpgrader returns an Upgrader taking over the listeners of the previous
+// process if this process was started by an upgrade
+func NewUpgrader() *Upgrader {
+	u := &Upgrader{
+		inherited: map[string]*os.File{},
+		listeners: map[string]net.Listener{},
+		upgraded:  make(chan struct{}),
+		args:      os.Args[1:],
+		log:       logger.WithName("upgrader"),
+	}
+	if v := os.Getenv(upgradeFdsEnv); v != "" {
+		os.Unsetenv(upgradeFdsEnv)
+		u.ready = os.NewFile(upgradeReadyFd, "upgrade-ready")
+		for i, name := range strings.Split(v, ",") {
+			u.inherited[name] = os.NewFile(uintptr(upgradeReadyFd+1+i), name)
+		}
+	}
+	return u
+}
+
+// Listen returns the listener inherited under name, or listens on addr if
+// there is none. Only listeners created by Listen are handed over.
+func (u *Upgrader) Listen(name, network, addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.listeners[name]; ok {
+		return nil, fmt.Errorf("listener %s already exists", name)
+	}
+
+	var lis net.Listener
+	var err error
+	if f, ok := u.inherited[name]; ok {
+		delete(u.inherited, name)
+		lis, err = net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited listener %s: %w", name, err)
+		}
+		u.log.Info("inherited listener", "name", name, "addr", lis.Addr())
+	} else if lis, err = net.Listen(network, addr); err != nil {
+		return nil, err
+	}
+	if _, ok := lis.(filer); !ok {
+		lis.Close()
+		return nil, fmt.Errorf("listener %s of type %T cannot be handed over", name, lis)
+	}
+	u.names = append(u.names, name)
+	u.listeners[name] = lis
+	return lis, nil
+}
+
+// Ready tells the previous process that this one serves, it starts draining
+// then. Call it once all listeners are created.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	// Listeners not taken over by this version are closed
+	for name, f := range u.inherited {
+		u.log.Warn("inherited listener not used", "name", name)
+		f.Close()
+		delete(u.inherited, name)
+	}
+	if u.ready == nil {
+		return nil
+	}
+	_, err := u.ready.Write([]byte{1})
+	u.ready.Close()
+	u.ready = nil
+	return err
+}
+
+// Done is closed once a new process took over the listeners
+func (u *Upgrader) Done() <-chan struct{} {
+	return u.upgraded
+}
+
+// Run upgrades on SIGUSR2 until ctx is cancelled. After a successful upgrade
+// it sends SIGTERM to this process to start the graceful shutdown and returns.
+// A failed upgrade is logged and this process keeps serving.
+func (u *Upgrader) Run(ctx context.Context) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sig:
+		}
+		u.log.Info("received upgrade signal")
+		if err := u.Upgrade(); err != nil {
+			u.log.Error(err, "upgrade failed, keep serving")
+			continue
+		}
+		return syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}
+}
+
+// Upgrade starts the new process with the listeners and waits until it is ready
+func (u *Upgrader) Upgrade() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	select {
+	case <-u.upgraded:
+		return errors.New("already upgraded")
+	default:
+	}
+
+	exe := u.exe
+	if exe == "" {
+		var err error
+		if exe, err = os.Executable(); err != nil {
+			return err
+		}
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+	files := []*os.File{readyW}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range u.names {
+		f, err := u.listeners[name].(filer).File()
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", name, err)
+		}
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(exe, u.args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), upgradeFdsEnv+"="+strings.Join(u.names, ","))
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Only the new process holds the write end now, reading fails if it exits
+	readyW.Close()
+	u.log.Info("started new process", "pid", cmd.Process.Pid, "listeners", strings.Join(u.names, ","))
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return fmt.Errorf("new process did not report ready: %w", err)
+		}
+	case err := <-exited:
+		return fmt.Errorf("new process exited: %v", err)
+	case <-time.After(upgradeReadyTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("new process not ready after %s", upgradeReadyTimeout)
+	}
+	u.log.Info("new process ready, draining", "pid", cmd.Process.Pid)
+	// The new process serves on the unix sockets now, closing ours must not remove them
+	for _, lis := range u.listeners {
+		if ul, ok := lis.(unlinker); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	close(u.upgraded)
+	return nil
+}
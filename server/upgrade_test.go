@@ -0,0 +1,65 @@
+//go:build !windows
+
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+// The new process of TestUpgradeHandsOverListener, it answers on the inherited listener
+func TestUpgradeChild(t *testing.T) {
+	if os.Getenv(upgradeFdsEnv) == "" {
+		t.Skip("only run by TestUpgradeHandsOverListener")
+	}
+	u := NewUpgrader()
+	lis, err := u.Listen("test", "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if err := u.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := lis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("new"))
+	conn.Close()
+}
+
+func TestUpgradeHandsOverListener(t *testing.T) {
+	u := NewUpgrader()
+	u.args = []string{"-test.run=^TestUpgradeChild$"}
+	lis, err := u.Listen("test", "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-u.Done():
+	default:
+		t.Fatal("Done not closed after the upgrade")
+	}
+	if err := u.Upgrade(); err == nil {
+		t.Fatal("upgraded twice")
+	}
+
+	// Once the old process closed the listener the new one serves on the same address
+	addr := lis.Addr().String()
+	lis.Close()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	b, err := io.ReadAll(conn)
+	if err != nil || string(b) != "new" {
+		t.Fatalf("got %q, %v from the new process", b, err)
+	}
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/karthikraman22/rpc-bp/config"
+	"github.com/karthikraman22/rpc-bp/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+const (
+	// InstrumentationName is the name of the tracers created by rpc-bp
+	InstrumentationName = "github.com/karthikraman22/rpc-bp"
+
+	ExporterOTLPHTTP = "otlphttp"
+	ExporterOTLPGRPC = "otlpgrpc"
+)
+
+// Options configures the OpenTelemetry tracer provider
+type Options struct {
+	// ServiceName is reported as service.name
+	ServiceName string
+	// ServiceVersion is reported as service.version
+	ServiceVersion string
+	// Exporter is either ExporterOTLPHTTP (default) or ExporterOTLPGRPC
+	Exporter string
+	// Endpoint of the collector as host:port
+	Endpoint string
+	// Insecure disables TLS towards the collector
+	Insecure bool
+	// Headers are sent with every export request, e.g. for authentication
+	Headers map[string]string
+	// SampleRatio of the root spans to record, 0 is treated as 1
+	SampleRatio float64
+}
+
+// OptionsFromConfig reads the options from the `tracing` section of the config
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		ServiceName:    cfg.String("application.name"),
+		ServiceVersion: cfg.String("version"),
+		Exporter:       cfg.String("tracing.exporter"),
+		Endpoint:       cfg.String("tracing.endpoint"),
+		Insecure:       cfg.Bool("tracing.insecure"),
+		Headers:        cfg.StringMap("tracing.headers"),
+		SampleRatio:    cfg.Float64("tracing.sampleratio"),
+	}
+}
+
+// InitFromConfig installs the global tracer provider if `tracing.enabled` is set.
+// The returned function flushes and stops the exporter.
+func InitFromConfig(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	if !cfg.Bool("tracing.enabled") {
+		logger.WithName("tracing").Info("tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+	return Init(ctx, OptionsFromConfig(cfg))
+}
+
+// Init installs a global tracer provider exporting to an OTLP collector and
+// the W3C trace context and baggage propagators.
+// The returned function flushes and stops the exporter.
+func Init(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	log := logger.WithName("tracing")
+
+	exporter, err := newExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(opts.ServiceName),
+		semconv.ServiceVersionKey.String(opts.ServiceVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := opts.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Error(err, "opentelemetry error")
+	}))
+
+	log.Info("tracing enabled", "exporter", opts.Exporter, "endpoint", opts.Endpoint, "sample_ratio", ratio)
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, opts Options) (*otlptrace.Exporter, error) {
+	switch opts.Exporter {
+	case "", ExporterOTLPHTTP:
+		o := []otlptracehttp.Option{}
+		if opts.Endpoint != "" {
+			o = append(o, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			o = append(o, otlptracehttp.WithInsecure())
+		}
+		if len(opts.Headers) > 0 {
+			o = append(o, otlptracehttp.WithHeaders(opts.Headers))
+		}
+		return otlptracehttp.New(ctx, o...)
+	case ExporterOTLPGRPC:
+		o := []otlptracegrpc.Option{}
+		if opts.Endpoint != "" {
+			o = append(o, otlptracegrpc.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			o = append(o, otlptracegrpc.WithInsecure())
+		}
+		if len(opts.Headers) > 0 {
+			o = append(o, otlptracegrpc.WithHeaders(opts.Headers))
+		}
+		return otlptracegrpc.New(ctx, o...)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", opts.Exporter)
+	}
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collectorStandIn records the span names of OTLP/HTTP export requests
+type collectorStandIn struct {
+	sync.Mutex
+	spans []string
+}
+
+func (c *collectorStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	req := &coltracepb.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.Lock()
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				c.spans = append(c.spans, s.GetName())
+			}
+		}
+	}
+	c.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	b, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Write(b)
+}
+
+func TestInitExportsSpans(t *testing.T) {
+	collector := &collectorStandIn{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	shutdown, err := Init(context.Background(), Options{
+		ServiceName: "rpc-bp-test",
+		Exporter:    ExporterOTLPHTTP,
+		Endpoint:    strings.TrimPrefix(srv.URL, "http://"),
+		Insecure:    true,
+	})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	_, span := otel.Tracer(InstrumentationName).Start(context.Background(), "test-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	collector.Lock()
+	defer collector.Unlock()
+	if len(collector.spans) != 1 || collector.spans[0] != "test-span" {
+		t.Fatalf("collector received %v", collector.spans)
+	}
+}
@@ -1 +1,170 @@
 package util
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/karthikraman22/rpc-bp/config"
+	"github.com/karthikraman22/rpc-bp/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Config key holding the additional headers to propagate
+const propagateHeadersKey = "headers.propagate"
+
+type propagatedKey struct{}
+
+// HeaderPropagator copies request scoped headers (correlation id, W3C trace
+// context and an allowlist of custom headers) of an incoming request to
+// outgoing calls. Client-sent x-forwarded-* headers are only passed on if
+// allowed explicitly, they cannot be trusted.
+type HeaderPropagator struct {
+	// Lower case names of the allowed custom headers
+	allowed map[string]struct{}
+}
+
+// NewHeaderPropagator returns a HeaderPropagator allowing the given custom headers
+func NewHeaderPropagator(headers ...string) *HeaderPropagator {
+	p := &HeaderPropagator{allowed: map[string]struct{}{}}
+	for _, h := range headers {
+		p.allowed[strings.ToLower(h)] = struct{}{}
+	}
+	return p
+}
+
+// NewHeaderPropagatorFromConfig returns a HeaderPropagator allowing the custom headers listed under `headers.propagate`
+func NewHeaderPropagatorFromConfig(cfg *config.Config) *HeaderPropagator {
+	return NewHeaderPropagator(cfg.Strings(propagateHeadersKey)...)
+}
+
+// Allowed reports whether the header is propagated
+func (p *HeaderPropagator) Allowed(name string) bool {
+	name = strings.ToLower(name)
+	if name == logger.CORRELATION_ID.String() {
+		return true
+	}
+	_, ok := p.allowed[name]
+	return ok
+}
+
+// FromHTTPHeader filters the propagated headers of an http header
+func (p *HeaderPropagator) FromHTTPHeader(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range h {
+		if p.Allowed(k) {
+			md.Append(k, v...)
+		}
+	}
+	return md
+}
+
+// FromMetadata filters the propagated headers of grpc metadata
+func (p *HeaderPropagator) FromMetadata(in metadata.MD) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range in {
+		if p.Allowed(k) {
+			md.Append(k, v...)
+		}
+	}
+	return md
+}
+
+// Extract returns the headers to propagate for the request ctx belongs to.
+// ctx may be a *gin.Context, a request context passed through GinHandler or
+// an incoming grpc context. The correlation id of ctx always wins.
+func (p *HeaderPropagator) Extract(ctx context.Context) metadata.MD {
+	var md metadata.MD
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		md = p.FromHTTPHeader(c.Request.Header)
+	} else if stored, ok := ctx.Value(propagatedKey{}).(metadata.MD); ok {
+		md = stored.Copy()
+	} else if in, ok := metadata.FromIncomingContext(ctx); ok {
+		md = p.FromMetadata(in)
+	} else {
+		md = metadata.MD{}
+	}
+	if id := logger.CorrelationID(ctx); id != "" {
+		md.Set(logger.CORRELATION_ID.String(), id)
+	}
+	// Continue the trace with the span of this process as parent
+	if tc, ok := logger.TraceContextFromContext(ctx); ok && tc.IsValid() {
+		md.Set(logger.TraceparentHeader, tc.Traceparent())
+		if tc.State != "" {
+			md.Set(logger.TracestateHeader, tc.State)
+		}
+		if tc.Baggage != "" {
+			md.Set(logger.BaggageHeader, tc.Baggage)
+		}
+	}
+	return md
+}
+
+// GinHandler stores the propagated headers in the request context, so
+// handlers can pass c.Request.Context() on to clients
+func (p *HeaderPropagator) GinHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		md := p.FromHTTPHeader(c.Request.Header)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), propagatedKey{}, md))
+		c.Next()
+	}
+}
+
+// OutgoingContext returns ctx with the propagated headers added to the outgoing grpc metadata
+func (p *HeaderPropagator) OutgoingContext(ctx context.Context) context.Context {
+	md := p.Extract(ctx)
+	if out, ok := metadata.FromOutgoingContext(ctx); ok {
+		// Explicitly set outgoing metadata takes precedence
+		for k, v := range out {
+			md[k] = v
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// InjectHTTP sets the propagated headers on an outgoing http request
+func (p *HeaderPropagator) InjectHTTP(ctx context.Context, req *http.Request) {
+	for k, v := range p.Extract(ctx) {
+		if req.Header.Get(k) != "" {
+			continue
+		}
+		for _, s := range v {
+			req.Header.Add(k, s)
+		}
+	}
+}
+
+// UnaryClientInterceptor propagates the headers of the incoming request on unary calls
+func (p *HeaderPropagator) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(p.OutgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor propagates the headers of the incoming request on streaming calls
+func (p *HeaderPropagator) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(p.OutgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
+
+// RoundTripper wraps next so requests sent with a context propagate its headers
+func (p *HeaderPropagator) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		// RoundTrippers must not modify the request
+		req = req.Clone(req.Context())
+		p.InjectHTTP(req.Context(), req)
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
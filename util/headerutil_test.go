@@ -0,0 +1,86 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/karthikraman22/rpc-bp/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestHeaderPropagatorMetadata(t *testing.T) {
+	p := NewHeaderPropagator("X-Request-Source")
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-correlation-id", "forged",
+		"x-request-source", "app",
+		"x-forwarded-for", "10.0.0.1",
+		"x-forwarded-remote-addr", "10.0.0.1",
+		"authorization", "Bearer secret",
+	))
+	ctx = logger.WithCorrelationID(ctx, "req-1")
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-request-source", "explicit")
+
+	var out metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		out, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	if err := p.UnaryClientInterceptor()(ctx, "/svc/Method", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	want := metadata.Pairs("x-correlation-id", "req-1", "x-request-source", "explicit")
+	if len(out) != len(want) {
+		t.Fatalf("got %v, want %v", out, want)
+	}
+	for k, v := range want {
+		if got := out.Get(k); len(got) != 1 || got[0] != v[0] {
+			t.Fatalf("%s: got %v, want %v", k, got, v)
+		}
+	}
+}
+
+func TestHeaderPropagatorHTTP(t *testing.T) {
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer upstream.Close()
+
+	p := NewHeaderPropagator("x-device-id")
+	client := &http.Client{Transport: p.RoundTripper(nil)}
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(p.GinHandler())
+	router.GET("/", func(c *gin.Context) {
+		req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, upstream.URL, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		res.Body.Close()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Correlation-Id", "req-2")
+	req.Header.Set("X-Device-Id", "device")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header.Set("X-Forwarded-Remote-Addr", "10.0.0.1")
+	req.Header.Set("Cookie", "session=secret")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	h := <-received
+	if h.Get("X-Correlation-Id") != "req-2" || h.Get("X-Device-Id") != "device" {
+		t.Fatalf("allowed headers not propagated: %v", h)
+	}
+	for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Remote-Addr", "Cookie"} {
+		if v := h.Get(name); v != "" {
+			t.Fatalf("%s propagated: %q", name, v)
+		}
+	}
+}
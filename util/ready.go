@@ -0,0 +1,18 @@
+package util
+
+import "context"
+
+type readyKey struct{}
+
+// WithReady returns a copy of ctx on which Ready calls ready
+func WithReady(ctx context.Context, ready func()) context.Context {
+	return context.WithValue(ctx, readyKey{}, ready)
+}
+
+// Ready reports that the work ctx was passed to serves, e.g. a server bound
+// its listener. It does nothing unless ctx was created by WithReady.
+func Ready(ctx context.Context) {
+	if ready, ok := ctx.Value(readyKey{}).(func()); ok {
+		ready()
+	}
+}
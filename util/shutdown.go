@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"sync"
@@ -20,13 +21,45 @@ const (
 	planned
 )
 
+// DefaultSignals start the shutdown unless NewShutdownWaitGroup is given others
+var DefaultSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT}
+
+// ShutdownWaitGroup listens for the shutdown signals. The first signal
+// cancels Context, runs the registered callbacks concurrently and then the
+// hooks. A second signal exits the process immediately.
 type ShutdownWaitGroup struct {
 	state int32 // Atomic variable defining the current state (see consts above)
 	sync.WaitGroup
+	// Hooks run after the shutdown callbacks
+	ShutdownHooks
+
+	signals   []os.Signal
+	ctx       context.Context
+	cancel    context.CancelFunc
+	listen    sync.Once
+	mu        sync.Mutex
+	callbacks []func()
+	sig       chan os.Signal
+	stopped   chan struct{}
+	stop      sync.Once
+	// Called on the second signal, os.Exit
+	exit func(code int)
 }
 
-func NewShutdownWaitGroup() *ShutdownWaitGroup {
-	return &ShutdownWaitGroup{}
+// NewShutdownWaitGroup returns a ShutdownWaitGroup for signals, DefaultSignals if none are given
+func NewShutdownWaitGroup(signals ...os.Signal) *ShutdownWaitGroup {
+	if len(signals) == 0 {
+		signals = DefaultSignals
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ShutdownWaitGroup{
+		signals: signals,
+		ctx:     ctx,
+		cancel:  cancel,
+		sig:     make(chan os.Signal, 2),
+		stopped: make(chan struct{}),
+		exit:    os.Exit,
+	}
 }
 
 func (s *ShutdownWaitGroup) IsExpected() bool {
@@ -38,29 +71,87 @@ func (s *ShutdownWaitGroup) Expect() {
 	atomic.StoreInt32(&s.state, planned)
 }
 
+// Context starts listening for the signals and returns a context cancelled on the first one
+func (s *ShutdownWaitGroup) Context() context.Context {
+	s.listen.Do(s.startListening)
+	return s.ctx
+}
+
+// RegisterSignalHandler adds a callback run on the first signal. Callbacks of
+// several subscribers run concurrently, a callback registered after the
+// signal was received runs right away.
 func (s *ShutdownWaitGroup) RegisterSignalHandler(shutdownCallback func()) {
-	// Change our internal state to `registered`, if this is called twice it panics!
-	swapped := atomic.CompareAndSwapInt32(&s.state, unplanned, registered)
-	if !swapped {
-		panic("shutdown signal handler registered twice!?")
+	atomic.CompareAndSwapInt32(&s.state, unplanned, registered)
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		s.Add(1)
+		go func() {
+			defer s.Done()
+			shutdownCallback()
+		}()
+		return
 	}
+	s.callbacks = append(s.callbacks, shutdownCallback)
+	s.mu.Unlock()
+	s.listen.Do(s.startListening)
+}
+
+// Stop stops listening for the signals, they get their default behaviour again
+func (s *ShutdownWaitGroup) Stop() {
+	s.stop.Do(func() {
+		signal.Stop(s.sig)
+		close(s.stopped)
+	})
+}
+
+func (s *ShutdownWaitGroup) startListening() {
+	signal.Notify(s.sig, s.signals...)
 	s.Add(1) // Increment wg for the signal routine
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		// Interrupt signal sent from terminal or on sigterm
-		signal.Notify(sigint, os.Interrupt)
-		signal.Notify(sigint, syscall.SIGTERM)
-		signal.Notify(sigint, syscall.SIGQUIT)
-		<-sigint
+		log := logger.WithName("shutdown-handler")
+		var first os.Signal
+		select {
+		case first = <-s.sig:
+		case <-s.stopped:
+			s.Done()
+			return
+		}
 		// We received a signal, so let's shutdown
-		logger.WithName("shutdown-handler").Info("received shutdown signal")
+		log.Info("received shutdown signal", "signal", first.String())
 		// Let's set the atomic properly to indicate planned shutdown behavior
-		swapped := atomic.CompareAndSwapInt32(&s.state, registered, planned)
-		if !swapped {
-			panic("signal was received but atomic had unexpected value")
+		atomic.StoreInt32(&s.state, planned)
+
+		// A second signal does not wait for the graceful shutdown
+		go func() {
+			var second os.Signal
+			select {
+			case second = <-s.sig:
+			case <-s.stopped:
+				return
+			}
+			log.Warn("received second shutdown signal, exiting immediately", "signal", second.String())
+			_ = logger.Sync()
+			s.exit(1)
+		}()
+
+		s.mu.Lock()
+		s.cancel()
+		callbacks := s.callbacks
+		s.mu.Unlock()
+
+		// Call the shutdown callbacks, then the hooks in order
+		var wg sync.WaitGroup
+		for _, cb := range callbacks {
+			cb := cb
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cb()
+			}()
 		}
-		// Call the shutdown callback
-		shutdownCallback()
+		wg.Wait()
+		s.RunHooks(context.Background())
 		s.Done() // Routine done, let wg know
 	}()
 }
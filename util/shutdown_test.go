@@ -0,0 +1,64 @@
+package util
+
+import (
+	"context"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitGroupSignals(t *testing.T) {
+	sw := NewShutdownWaitGroup(syscall.SIGUSR1)
+	defer sw.Stop()
+	exited := make(chan int, 1)
+	sw.exit = func(code int) { exited <- code }
+
+	var calls int32
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		sw.RegisterSignalHandler(func() {
+			atomic.AddInt32(&calls, 1)
+			<-release
+		})
+	}
+	var hooked int32
+	sw.AddHookFunc("hook", PriorityServers, time.Second, func(context.Context) error {
+		atomic.AddInt32(&hooked, 1)
+		return nil
+	})
+	ctx := sw.Context()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled on the first signal")
+	}
+	if !sw.IsExpected() {
+		t.Fatal("shutdown not expected after the signal")
+	}
+
+	// The callbacks block, the second signal must not wait for them
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case code := <-exited:
+		if code != 1 {
+			t.Fatalf("unexpected exit code %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second signal did not exit")
+	}
+
+	close(release)
+	if !sw.WaitOrTimeout(time.Second) {
+		t.Fatal("callbacks and hooks did not finish")
+	}
+	if atomic.LoadInt32(&calls) != 2 || atomic.LoadInt32(&hooked) != 1 {
+		t.Fatalf("unexpected calls %d, hooks %d", calls, hooked)
+	}
+}
@@ -0,0 +1,188 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+	"go.uber.org/multierr"
+)
+
+// Priorities of the usual shutdown hooks, lower priorities run first
+const (
+	PriorityServers  = 0
+	PriorityWorkers  = 100
+	PriorityDatabase = 200
+	PriorityLoggers  = 1000
+)
+
+// ShutdownHook is a named step of the shutdown. Hooks run in ascending
+// Priority, hooks of the same priority run concurrently.
+type ShutdownHook struct {
+	Name     string
+	Priority int
+	// Timeout of the hook, its ctx is cancelled after it. Zero means no limit.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// HookResult is the outcome of a single hook
+type HookResult struct {
+	Name     string
+	Priority int
+	Duration time.Duration
+	Err      error
+	// TimedOut is set if the hook did not return within its timeout
+	TimedOut bool
+}
+
+// ShutdownReport lists the outcome of all hooks in the order they ran
+type ShutdownReport []HookResult
+
+// TimedOut returns the names of the hooks exceeding their timeout
+func (r ShutdownReport) TimedOut() []string {
+	names := []string{}
+	for _, res := range r {
+		if res.TimedOut {
+			names = append(names, res.Name)
+		}
+	}
+	return names
+}
+
+// Err combines the errors of all failed hooks
+func (r ShutdownReport) Err() error {
+	var errs error
+	for _, res := range r {
+		if res.Err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", res.Name, res.Err))
+		}
+	}
+	return errs
+}
+
+// ShutdownHooks is an ordered registry of shutdown hooks
+type ShutdownHooks struct {
+	mu    sync.Mutex
+	hooks []ShutdownHook
+}
+
+// AddHook registers a hook
+func (h *ShutdownHooks) AddHook(hook ShutdownHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hook)
+}
+
+// AddHookFunc registers fn as hook
+func (h *ShutdownHooks) AddHookFunc(name string, priority int, timeout time.Duration, fn func(ctx context.Context) error) {
+	h.AddHook(ShutdownHook{Name: name, Priority: priority, Timeout: timeout, Run: fn})
+}
+
+// Timeout is the longest time RunHooks takes if all hooks have a timeout: the
+// sum of the largest timeout of each priority
+func (h *ShutdownHooks) Timeout() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	longest := map[int]time.Duration{}
+	for _, hook := range h.hooks {
+		if hook.Timeout > longest[hook.Priority] {
+			longest[hook.Priority] = hook.Timeout
+		}
+	}
+	var total time.Duration
+	for _, d := range longest {
+		total += d
+	}
+	return total
+}
+
+// RunHooks runs the registered hooks by priority. A hook
+// exceeding its timeout is reported and left running in the background, the
+// next priority starts anyway. Cancelling ctx cancels the hooks still running.
+func (h *ShutdownHooks) RunHooks(ctx context.Context) ShutdownReport {
+	h.mu.Lock()
+	hooks := append([]ShutdownHook{}, h.hooks...)
+	h.mu.Unlock()
+
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].Priority < hooks[j].Priority })
+
+	log := logger.WithName("shutdown-handler")
+	report := make(ShutdownReport, 0, len(hooks))
+	for start := 0; start < len(hooks); {
+		end := start
+		for end < len(hooks) && hooks[end].Priority == hooks[start].Priority {
+			end++
+		}
+		results := make([]HookResult, end-start)
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i-start] = runHook(ctx, hooks[i])
+			}()
+		}
+		wg.Wait()
+		for _, res := range results {
+			switch {
+			case res.TimedOut:
+				log.Warn("shutdown hook timed out", "hook", res.Name, "priority", res.Priority, "duration_ms", res.Duration.Milliseconds())
+			case res.Err != nil:
+				log.Error(res.Err, "shutdown hook failed", "hook", res.Name, "priority", res.Priority)
+			default:
+				log.Info("shutdown hook done", "hook", res.Name, "priority", res.Priority, "duration_ms", res.Duration.Milliseconds())
+			}
+		}
+		report = append(report, results...)
+		start = end
+	}
+	if timedOut := report.TimedOut(); len(timedOut) > 0 {
+		log.Warn("shutdown hooks timed out", "hooks", strings.Join(timedOut, ", "))
+	}
+	return report
+}
+
+func runHook(ctx context.Context, hook ShutdownHook) HookResult {
+	res := HookResult{Name: hook.Name, Priority: hook.Priority}
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		done <- hook.Run(ctx)
+	}()
+	select {
+	case res.Err = <-done:
+	case <-ctx.Done():
+		res.Err = ctx.Err()
+		res.TimedOut = errors.Is(res.Err, context.DeadlineExceeded)
+	}
+	res.Duration = time.Since(start)
+	return res
+}
+
+// LoggerSyncHook flushes the buffered lines of all loggers, it runs last
+func LoggerSyncHook() ShutdownHook {
+	return ShutdownHook{
+		Name:     "logger-sync",
+		Priority: PriorityLoggers,
+		Timeout:  5 * time.Second,
+		Run:      func(context.Context) error { return logger.Sync() },
+	}
+}
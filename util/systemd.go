@@ -0,0 +1,106 @@
+package util
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+// sdNotifier sends READY=1 and STOPPING=1 and runs the watchdog once, even
+// with several servers in the process
+type sdNotifier struct {
+	serving  sync.Once
+	stopping sync.Once
+}
+
+var sdProcess = &sdNotifier{}
+
+// SdNotify sends state to systemd, e.g. "READY=1". It does nothing unless
+// the unit is Type=notify, i.e. NOTIFY_SOCKET is set.
+func SdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	// Abstract socket
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// SdServing reports the process ready to systemd and pings the watchdog until
+// stop is called. Only the first call of the process notifies, later calls
+// return a stop doing nothing, so call it once everything serves.
+func SdServing(log logger.Logger) (stop func()) {
+	return sdProcess.ready(log)
+}
+
+// SdStopping reports to systemd that the process started its shutdown, only
+// the first call of the process notifies
+func SdStopping(log logger.Logger) {
+	sdProcess.stop(log)
+}
+
+func (n *sdNotifier) stop(log logger.Logger) {
+	n.stopping.Do(func() {
+		if err := SdNotify("STOPPING=1"); err != nil {
+			log.Error(err, "systemd notify failed", "state", "STOPPING=1")
+		}
+	})
+}
+
+func (n *sdNotifier) ready(log logger.Logger) (stop func()) {
+	stop = func() {}
+	n.serving.Do(func() { stop = sdServing(log) })
+	return stop
+}
+
+// sdServing sends READY=1 and pings the watchdog until stop is called
+func sdServing(log logger.Logger) (stop func()) {
+	if err := SdNotify("READY=1"); err != nil {
+		log.Error(err, "systemd notify failed", "state", "READY=1")
+	}
+	done := make(chan struct{})
+	if interval := sdWatchdogInterval(); interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := SdNotify("WATCHDOG=1"); err != nil {
+						log.Error(err, "systemd notify failed", "state", "WATCHDOG=1")
+					}
+				}
+			}
+		}()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// sdWatchdogInterval is how often the watchdog is pinged, half the
+// WatchdogSec= of the unit, 0 if the watchdog is disabled
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karthikraman22/rpc-bp/logger"
+)
+
+func TestSdNotify(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", addr)
+
+	if err := SdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 64)
+	n, err := conn.Read(b)
+	if err != nil || string(b[:n]) != "READY=1" {
+		t.Fatalf("got %q, %v", b[:n], err)
+	}
+}
+
+func TestSdNotifierOnce(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", addr)
+	t.Setenv("WATCHDOG_USEC", "40000")
+
+	var states []string
+	read := func() {
+		b := make([]byte, 64)
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		for {
+			n, err := conn.Read(b)
+			if err != nil {
+				return
+			}
+			states = append(states, string(b[:n]))
+		}
+	}
+
+	log := logger.WithName("systemd-test")
+	n := &sdNotifier{}
+	stop := n.ready(log)
+	// A second server of the process neither reports ready nor pings the watchdog
+	n.ready(log)()
+	read()
+	stop()
+	n.stop(log)
+	n.stop(log)
+	read()
+
+	ready, watchdog, stopping := 0, 0, 0
+	for _, s := range states {
+		switch s {
+		case "READY=1":
+			ready++
+		case "WATCHDOG=1":
+			watchdog++
+		case "STOPPING=1":
+			stopping++
+		}
+	}
+	// 100ms at a 20ms interval from a single watchdog
+	if ready != 1 || stopping != 1 || watchdog < 2 || watchdog > 6 {
+		t.Fatalf("got %v", states)
+	}
+}